@@ -0,0 +1,68 @@
+package filecache
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Touch marks the entry of key as accessed now, as a Read would.
+func (f *FileCache) Touch(ctx context.Context, key string) error {
+	return opError("touch", key, f.touchEntry(ctx, key))
+}
+
+func (f *FileCache) touchEntry(ctx context.Context, key string) error {
+	if err := f.validateKey(key); err != nil {
+		return err
+	}
+	if _, err := f.hasFile(ctx, key); err != nil {
+		return err
+	}
+	return f.recordAccess(ctx, key, time.Now())
+}
+
+// recordAccess updates the modification time of the entry of key and, if
+// enabled, its persisted access time and count.
+func (f *FileCache) recordAccess(ctx context.Context, key string, ts time.Time) error {
+	if err := f.touch(key, ts); err != nil {
+		return err
+	}
+	if !f.PersistAccessTime && !f.PersistAccessCount {
+		return nil
+	}
+	return f.updateSidecar(ctx, key, func(sc *sidecar) {
+		if f.PersistAccessTime {
+			sc.AccessedAt = ts.UnixNano()
+		}
+		if f.PersistAccessCount {
+			sc.Hits++
+		}
+	})
+}
+
+// accessTime returns the persisted access time of file, falling back to its
+// modification time.
+func (f *FileCache) accessTime(file fs.FileInfo) time.Time {
+	sc, err := f.readSidecar(f.nameKey(file.Name()))
+	if err != nil || sc.AccessedAt == 0 {
+		return file.ModTime()
+	}
+	return time.Unix(0, sc.AccessedAt)
+}
+
+// sortByAccessTime orders files by their persisted access time, ties are
+// broken by name.
+func (f *FileCache) sortByAccessTime(files []fs.FileInfo) {
+	times := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		times[file.Name()] = f.accessTime(file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		ti, tj := times[files[i].Name()], times[files[j].Name()]
+		if ti.Equal(tj) {
+			return files[i].Name() < files[j].Name()
+		}
+		return ti.Before(tj)
+	})
+}
@@ -0,0 +1,34 @@
+package filecache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPersistAccessTime(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)) * 2, PersistAccessTime: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader(data))
+	fc.Write(ctx, "key2", sampleReader(data))
+	fc.Write(ctx, "key3", sampleReader(data))
+	if err := fc.Touch(ctx, "key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a scrub rewinding the mod times must not change the eviction order
+	for _, key := range []string{"key1", "key2", "key3"} {
+		fc.touch(key, time.Now().Add(-time.Minute))
+	}
+
+	if _, _, err := fc.cleanCachedFileByLRU(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key2") || !fc.Has("key1") || !fc.Has("key3") {
+		t.Fatal("least recently accessed entry must be evicted")
+	}
+}
@@ -0,0 +1,134 @@
+package filecache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// admission bounds the number of concurrent writes. Writes in flight hold
+// the gate shared, so Empty can hold it exclusively to wait for them and
+// keep new ones out.
+type admission struct {
+	slots    chan struct{}
+	gate     gate
+	inFlight int64
+	queued   int64
+}
+
+func newAdmission(max int) *admission {
+	a := &admission{}
+	if max > 0 {
+		a.slots = make(chan struct{}, max)
+	}
+	return a
+}
+
+func (a *admission) acquire(ctx context.Context) error {
+	if a.slots != nil {
+		atomic.AddInt64(&a.queued, 1)
+		defer atomic.AddInt64(&a.queued, -1)
+		select {
+		case a.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := a.gate.rlock(ctx); err != nil {
+		if a.slots != nil {
+			<-a.slots
+		}
+		return err
+	}
+	atomic.AddInt64(&a.inFlight, 1)
+	return nil
+}
+
+func (a *admission) release() {
+	atomic.AddInt64(&a.inFlight, -1)
+	a.gate.runlock()
+	if a.slots != nil {
+		<-a.slots
+	}
+}
+
+// gate is a readers-writer lock whose waits end when their context is
+// done. A pending writer keeps new readers out, like sync.RWMutex.
+type gate struct {
+	mutex   sync.Mutex
+	readers int
+	// closed is closed when the writer holding or waiting for the gate
+	// releases it, nil when there is none.
+	closed chan struct{}
+	// drained is closed when the last reader leaves a pending writer.
+	drained chan struct{}
+}
+
+func (g *gate) rlock(ctx context.Context) error {
+	for {
+		g.mutex.Lock()
+		closed := g.closed
+		if closed == nil {
+			g.readers++
+			g.mutex.Unlock()
+			return nil
+		}
+		g.mutex.Unlock()
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (g *gate) runlock() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.readers--; g.readers == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+func (g *gate) lock(ctx context.Context) error {
+	for {
+		g.mutex.Lock()
+		closed := g.closed
+		if closed == nil {
+			break
+		}
+		g.mutex.Unlock()
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	g.closed = make(chan struct{})
+	if g.readers == 0 {
+		g.mutex.Unlock()
+		return nil
+	}
+	drained := make(chan struct{})
+	g.drained = drained
+	g.mutex.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		g.mutex.Lock()
+		g.drained = nil
+		g.mutex.Unlock()
+		g.unlock()
+		return ctx.Err()
+	}
+}
+
+func (g *gate) unlock() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	close(g.closed)
+	g.closed = nil
+}
@@ -0,0 +1,140 @@
+package filecache
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// paxSidecarRecord is the PAX record holding the sidecar of an entry.
+const paxSidecarRecord = "FILECACHE.sidecar"
+
+// Export writes every entry of the cache and of its namespaces to w as a
+// tar archive. Entries are named by their key, prefixed by the namespace
+// path, and keep their modification time and metadata. Reading entries
+// for the export does not count as an access.
+func (f *FileCache) Export(ctx context.Context, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		prefix := strings.TrimPrefix(strings.TrimPrefix(c.namespace, f.namespace), "/")
+		files, err := c.files(ctx)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(file, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = path.Join(prefix, file.Name())
+			if err := c.exportFile(tw, hdr); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func (f *FileCache) exportFile(tw *tar.Writer, hdr *tar.Header) error {
+	key := f.nameKey(path.Base(hdr.Name))
+	file, err := os.Open(f.absFilePath(key))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sc, err := f.readSidecar(key)
+	if err != nil {
+		return err
+	}
+	if !sc.isZero() {
+		data, err := json.Marshal(sc)
+		if err != nil {
+			return err
+		}
+		hdr.Format = tar.FormatPAX
+		hdr.PAXRecords = map[string]string{paxSidecarRecord: string(data)}
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// Import reads a tar archive produced by Export and writes its entries
+// through the normal atomic write path, restoring their modification time.
+// Entries of namespaces are imported into the matching namespace. Keys
+// which already exist are left untouched.
+func (f *FileCache) Import(ctx context.Context, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		c := f
+		name := path.Clean(hdr.Name)
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return fmt.Errorf("invalid archive entry %q", hdr.Name)
+		}
+		parts := strings.Split(name, "/")
+		for _, ns := range parts[:len(parts)-1] {
+			if c, err = c.OpenNamespace(ns); err != nil {
+				return fmt.Errorf("invalid archive entry %q: %w", hdr.Name, err)
+			}
+		}
+		key := c.nameKey(parts[len(parts)-1])
+		var imported sidecar
+		data, hasSidecar := hdr.PAXRecords[paxSidecarRecord]
+		if hasSidecar {
+			if err := json.Unmarshal([]byte(data), &imported); err != nil {
+				return err
+			}
+			// hashed names are not keys, the key is in the sidecar
+			if isHashedName(key) && len(imported.Key) > 0 {
+				key = imported.Key
+			}
+		}
+
+		if err := c.WriteAt(ctx, key, tr, hdr.ModTime); err != nil {
+			if errors.Is(err, ErrKeyExists) {
+				f.Logger.WithField("key", name).Debug("Skipped importing existing key")
+				continue
+			}
+			return err
+		}
+		if hasSidecar {
+			err := c.updateSidecar(ctx, key, func(sc *sidecar) {
+				size := sc.Size
+				*sc = imported
+				if sc.Size == 0 {
+					sc.Size = size
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package filecache
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	src := MustNew(Config{BaseDir: "filecache/src", TempDir: "tmp"}, nil)
+	defer src.Empty(ctx)
+	dst := MustNew(Config{BaseDir: "filecache/dst", TempDir: "tmp"}, nil)
+	defer dst.Empty(ctx)
+
+	if err := src.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Namespace("thumbs").Write(ctx, "key", sampleReader("DEF")); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetMeta(ctx, "key", map[string]string{"etag": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	src.touch("key", modTime)
+
+	var buf bytes.Buffer
+	if err := src.Export(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Import(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := dst.Stat(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 3 || !info.ModTime.Equal(modTime) {
+		t.Fatal("imported entry must keep its size and mod time", info)
+	}
+	if meta, _ := dst.GetMeta(ctx, "key"); meta["etag"] != "1" {
+		t.Fatal("imported entry must keep its metadata", meta)
+	}
+	if !dst.Namespace("thumbs").Has("key") {
+		t.Fatal("namespaced entry must be imported into its namespace")
+	}
+}
+
+func TestExportImportHashedKeys(t *testing.T) {
+	ctx := context.Background()
+
+	src := MustNew(Config{BaseDir: "filecache/src", TempDir: "tmp", KeyEncoder: HashedKeys}, nil)
+	defer src.Empty(ctx)
+	dst := MustNew(Config{BaseDir: "filecache/dst", TempDir: "tmp", KeyEncoder: HashedKeys}, nil)
+	defer dst.Empty(ctx)
+
+	if err := src.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := src.Export(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Import(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := dst.Keys(); len(keys) != 1 || keys[0] != "key" {
+		t.Fatal("hashed entries must be imported under their key", keys)
+	}
+}
+
+func TestImportInvalidNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	for _, name := range []string{shardDirName + "/key", `a\b/key`} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 3})
+		tw.Write([]byte("ABC"))
+		tw.Close()
+
+		if err := fc.Import(ctx, &buf); err == nil {
+			t.Fatal("entry of an invalid namespace must be rejected", name)
+		}
+	}
+}
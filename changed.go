@@ -0,0 +1,95 @@
+package filecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// defaultHashAlgorithm is the name of the default hash, SHA-256.
+const defaultHashAlgorithm = "sha256"
+
+// WriteIfChanged writes the entry of key, replacing the existing one only
+// if its content differs. When the content is unchanged the existing entry
+// is left untouched, so its TTL and LRU position are not reset, and false
+// is returned.
+//
+// The incoming stream is hashed with Config.Hasher while it is staged to
+// the temp file, so it is not buffered in memory. The checksum is recorded
+// in the sidecar of the entry, the existing entry is only read back to be
+// compared when it has no checksum of the same algorithm.
+func (f *FileCache) WriteIfChanged(ctx context.Context, key string, r io.Reader) (bool, error) {
+	changed, err := f.writeIfChanged(ctx, key, r)
+	return changed, opError("write", key, err)
+}
+
+func (f *FileCache) writeIfChanged(ctx context.Context, key string, r io.Reader) (bool, error) {
+	w, err := f.create(ctx, key, WriteOptions{Overwrite: true})
+	if err != nil {
+		return false, err
+	}
+	w.hash = f.newHash()
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return false, err
+	}
+
+	sum, err := f.fileHash(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		w.Abort()
+		return false, err
+	}
+	if err == nil && bytes.Equal(sum, w.hash.Sum(nil)) {
+		return false, w.Abort()
+	}
+	if err := w.Close(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newHash returns a new hash of Config.Hasher.
+func (f *FileCache) newHash() hash.Hash {
+	if f.Hasher == nil {
+		return sha256.New()
+	}
+	return f.Hasher()
+}
+
+// hashAlgorithm returns the name of the hash of Config.Hasher.
+func (f *FileCache) hashAlgorithm() string {
+	if f.Hasher == nil {
+		return defaultHashAlgorithm
+	}
+	return f.HashAlgorithm
+}
+
+// fileHash returns the checksum of the content of key, taken from its
+// sidecar when it was recorded with the same algorithm.
+func (f *FileCache) fileHash(ctx context.Context, key string) ([]byte, error) {
+	absFilePath, err := f.hasFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if sc, err := f.readSidecar(key); err == nil && sc.ChecksumAlgorithm == f.hashAlgorithm() {
+		if sum, err := hex.DecodeString(sc.Checksum); err == nil && len(sum) > 0 {
+			return sum, nil
+		}
+	}
+	file, err := os.Open(absFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := f.newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,88 @@
+package filecache
+
+import (
+	"context"
+	"crypto/sha512"
+	"hash"
+	"hash/fnv"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWriteIfChanged(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("ABC")); err != nil || !changed {
+		t.Fatal("new key must be written", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	fc.touch("key", old)
+
+	if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("ABC")); err != nil || changed {
+		t.Fatal("same content must be skipped", err)
+	}
+	if info, _ := fc.Stat(ctx, "key"); !info.ModTime.Equal(old) {
+		t.Fatal("skipped write must not reset the mod time")
+	}
+
+	if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("DEF")); err != nil || !changed {
+		t.Fatal("changed content must be written", err)
+	}
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "DEF" {
+		t.Fatal("data not match")
+	}
+}
+
+func TestHasher(t *testing.T) {
+	ctx := context.Background()
+
+	for _, hasher := range []struct {
+		name string
+		new  func() hash.Hash
+	}{
+		{"sha512", sha512.New},
+		{"fnv128a", fnv.New128a},
+	} {
+		fc := MustNew(Config{TempDir: "tmp", Hasher: hasher.new, HashAlgorithm: hasher.name}, nil)
+
+		if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("ABC")); err != nil || !changed {
+			t.Fatal("new key must be written", hasher.name, err)
+		}
+		sc, _ := fc.readSidecar("key")
+		if sc.ChecksumAlgorithm != hasher.name || len(sc.Checksum) != 2*hasher.new().Size() {
+			t.Fatal("sidecar must record the checksum and its algorithm", hasher.name, sc)
+		}
+		if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("ABC")); err != nil || changed {
+			t.Fatal("same content must be skipped", hasher.name, err)
+		}
+		if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("DEF")); err != nil || !changed {
+			t.Fatal("changed content must be written", hasher.name, err)
+		}
+	}
+
+	// a cache switching to the default algorithm recomputes the checksum
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("DEF")); err != nil || changed {
+		t.Fatal("same content of another algorithm must be skipped", err)
+	}
+	if changed, err := fc.WriteIfChanged(ctx, "key", sampleReader("GHI")); err != nil || !changed {
+		t.Fatal("changed content must be written", err)
+	}
+	if sc, _ := fc.readSidecar("key"); sc.ChecksumAlgorithm != defaultHashAlgorithm {
+		t.Fatal("sidecar must record the new algorithm", sc)
+	}
+
+	if _, err := New(Config{TempDir: "tmp", Hasher: sha512.New384}, nil); err == nil {
+		t.Fatal("a hasher without an algorithm name must be rejected")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package filecache
+
+// checkSameDevice can not compare filesystems on this platform, a temp dir
+// on another filesystem fails when the entry is renamed into place.
+func checkSameDevice(baseDir, dir string) error {
+	return nil
+}
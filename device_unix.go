@@ -0,0 +1,30 @@
+//go:build unix
+
+package filecache
+
+import (
+	"os"
+	"syscall"
+)
+
+// checkSameDevice returns ErrCrossDevice if dir is not on the same
+// filesystem as baseDir.
+func checkSameDevice(baseDir, dir string) error {
+	base, err := os.Stat(baseDir)
+	if err != nil {
+		return err
+	}
+	other, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !other.IsDir() {
+		return &os.PathError{Op: "stat", Path: dir, Err: syscall.ENOTDIR}
+	}
+	bs, ok1 := base.Sys().(*syscall.Stat_t)
+	ds, ok2 := other.Sys().(*syscall.Stat_t)
+	if ok1 && ok2 && bs.Dev != ds.Dev {
+		return ErrCrossDevice
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package filecache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// checkSameDevice returns ErrCrossDevice if dir is not on the same
+// volume as baseDir.
+func checkSameDevice(baseDir, dir string) error {
+	other, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !other.IsDir() {
+		return &os.PathError{Op: "stat", Path: dir, Err: syscall.ENOTDIR}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(filepath.VolumeName(baseDir), filepath.VolumeName(abs)) {
+		return ErrCrossDevice
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !aix && !openbsd && !netbsd && !solaris && !windows
+
+package filecache
+
+// statDiskSpace is not supported on this platform, watermarks given as a
+// percentage and MinFreeSpace are disabled.
+func statDiskSpace(dir string) (total, free int64, err error) {
+	return 0, 0, errDiskSpaceUnsupported
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || dragonfly || aix
+
+package filecache
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// statDiskSpace returns the size of the filesystem of dir and the space left
+// on it for unprivileged users, in bytes.
+func statDiskSpace(dir string) (total, free int64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, 0, &os.PathError{Op: "statfs", Path: dir, Err: err}
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
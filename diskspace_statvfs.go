@@ -0,0 +1,19 @@
+//go:build netbsd || solaris
+
+package filecache
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// statDiskSpace returns the size of the filesystem of dir and the space left
+// on it for unprivileged users, in bytes.
+func statDiskSpace(dir string) (total, free int64, err error) {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(dir, &st); err != nil {
+		return 0, 0, &os.PathError{Op: "statvfs", Path: dir, Err: err}
+	}
+	return int64(st.Blocks) * int64(st.Frsize), int64(st.Bavail) * int64(st.Frsize), nil
+}
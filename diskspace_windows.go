@@ -0,0 +1,21 @@
+package filecache
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// statDiskSpace returns the size of the volume of dir and the space left on it
+// for the user, in bytes.
+func statDiskSpace(dir string) (total, free int64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var available, size, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &size, &totalFree); err != nil {
+		return 0, 0, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: dir, Err: err}
+	}
+	return int64(size), int64(available), nil
+}
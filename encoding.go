@@ -0,0 +1,54 @@
+package filecache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// Encoding is the content coding of the bytes of an entry, named like in
+// the HTTP Content-Encoding header.
+type Encoding string
+
+const (
+	// EncodingIdentity is the encoding of entries stored as is.
+	EncodingIdentity Encoding = "identity"
+	// EncodingGzip is the encoding of entries stored gzipped.
+	EncodingGzip Encoding = "gzip"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ReadRaw returns a reader of the bytes of the entry of key as stored on
+// disk, along with their encoding, so a gzipped entry can be passed through
+// to a client accepting gzip instead of being decompressed and compressed
+// again. The cache does not compress entries itself: the encoding is
+// detected from the content, an entry written gzipped by the caller is
+// reported as EncodingGzip. It counts as an access like Read.
+func (f *FileCache) ReadRaw(ctx context.Context, key string) (io.ReadCloser, Encoding, error) {
+	r, encoding, err := f.readRaw(ctx, key)
+	return r, encoding, opError("read", key, err)
+}
+
+func (f *FileCache) readRaw(ctx context.Context, key string) (io.ReadCloser, Encoding, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, "", err
+	}
+	r, err := f.read(ctx, key, !f.DisableTouch)
+	if err != nil {
+		return nil, "", err
+	}
+	file := r.(*os.File)
+	magic := make([]byte, len(gzipMagic))
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, "", err
+	}
+	if bytes.Equal(magic[:n], gzipMagic) {
+		return file, EncodingGzip, nil
+	}
+	return file, EncodingIdentity, nil
+}
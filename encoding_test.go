@@ -0,0 +1,47 @@
+package filecache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestReadRaw(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("ABC"))
+	zw.Close()
+	compressed := buf.Bytes()
+
+	fc.Write(ctx, "gzipped", bytes.NewReader(compressed))
+	fc.Write(ctx, "plain", sampleReader("ABC"))
+	fc.Write(ctx, "empty", sampleReader(""))
+
+	r, encoding, err := fc.ReadRaw(ctx, "gzipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if encoding != EncodingGzip || !bytes.Equal(data, compressed) {
+		t.Fatal("gzipped entry must be returned as stored", encoding)
+	}
+
+	for _, key := range []string{"plain", "empty"} {
+		r, encoding, err := fc.ReadRaw(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if encoding != EncodingIdentity {
+			t.Fatal("plain entry must have the identity encoding", key, encoding)
+		}
+	}
+}
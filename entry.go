@@ -0,0 +1,71 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrCacheEmpty is returned when the cache has no entries.
+var ErrCacheEmpty = errors.New("cache is empty")
+
+// EntryInfo describes a cached entry.
+type EntryInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+func (f *FileCache) newEntryInfo(file fs.FileInfo) EntryInfo {
+	return EntryInfo{Key: f.entryKey(file.Name()), Size: file.Size(), ModTime: file.ModTime()}
+}
+
+// Stat returns the info of the entry of key without touching it.
+func (f *FileCache) Stat(ctx context.Context, key string) (EntryInfo, error) {
+	info, err := f.stat(ctx, key)
+	return info, opError("stat", key, err)
+}
+
+func (f *FileCache) stat(ctx context.Context, key string) (EntryInfo, error) {
+	if err := f.validateKey(key); err != nil {
+		return EntryInfo{}, err
+	}
+	absFilePath, err := f.hasFile(ctx, key)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	file, err := os.Stat(absFilePath)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	return EntryInfo{Key: key, Size: file.Size(), ModTime: file.ModTime()}, nil
+}
+
+// Oldest returns the least recently used entry, which is the next one to
+// be evicted by the LRU cleaner.
+func (f *FileCache) Oldest(ctx context.Context) (string, EntryInfo, error) {
+	files, err := f.files(ctx)
+	if err != nil {
+		return "", EntryInfo{}, err
+	}
+	if len(files) == 0 {
+		return "", EntryInfo{}, ErrCacheEmpty
+	}
+	info := f.newEntryInfo(files[0])
+	return info.Key, info, nil
+}
+
+// Newest returns the most recently used entry.
+func (f *FileCache) Newest(ctx context.Context) (string, EntryInfo, error) {
+	files, err := f.files(ctx)
+	if err != nil {
+		return "", EntryInfo{}, err
+	}
+	if len(files) == 0 {
+		return "", EntryInfo{}, ErrCacheEmpty
+	}
+	info := f.newEntryInfo(files[len(files)-1])
+	return info.Key, info, nil
+}
@@ -0,0 +1,55 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOldestNewest(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if _, _, err := fc.Oldest(ctx); !errors.Is(err, ErrCacheEmpty) {
+		t.Fatal("must be empty cache error", err)
+	}
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		if err := fc.Write(ctx, key, sampleReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fc.touch("key2", time.Now().Add(-time.Minute))
+	fc.touch("key1", time.Now().Add(time.Minute))
+
+	if key, info, err := fc.Oldest(ctx); err != nil || key != "key2" || info.Size != 4 {
+		t.Fatal("oldest must be key2", key, err)
+	}
+	if key, _, err := fc.Newest(ctx); err != nil || key != "key1" {
+		t.Fatal("newest must be key1", key, err)
+	}
+}
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if _, err := fc.Stat(ctx, "key"); err == nil {
+		t.Fatal("must not found")
+	}
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fc.Stat(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "key" || info.Size != 3 {
+		t.Fatal("info not match", info)
+	}
+}
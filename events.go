@@ -0,0 +1,118 @@
+package filecache
+
+import (
+	"sync"
+	"time"
+)
+
+// eventBuffer is the number of events kept for a slow reader of Events,
+// further events are dropped.
+const eventBuffer = 1024
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventWritten is an entry committed by a write.
+	EventWritten EventType = iota + 1
+	// EventRead is an entry served by a read.
+	EventRead
+	// EventDeleted is an entry removed by Delete.
+	EventDeleted
+	// EventEvicted is an entry removed by the GC, to make room for a write
+	// or once expired.
+	EventEvicted
+	// EventGC is a completed GC run.
+	EventGC
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventWritten:
+		return "written"
+	case EventRead:
+		return "read"
+	case EventDeleted:
+		return "deleted"
+	case EventEvicted:
+		return "evicted"
+	case EventGC:
+		return "gc-run"
+	}
+	return "unknown"
+}
+
+// Event is an activity of a cache.
+type Event struct {
+	Type EventType
+	// Namespace is the namespace of the entry, empty for the root cache.
+	Namespace string
+	Key       string
+	Size      int64
+	// Reason tells why the entry was written, read or removed, as for
+	// Hooks.
+	Reason Reason
+	// GC is the report of the run of an EventGC.
+	GC   GCReport
+	Time time.Time
+}
+
+// eventBus delivers the events of a root cache and its namespaces, its
+// channel is only made once Events is called.
+type eventBus struct {
+	mutex  sync.Mutex
+	c      chan Event
+	closed bool
+}
+
+func (b *eventBus) subscribe() <-chan Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.c == nil {
+		b.c = make(chan Event, eventBuffer)
+		if b.closed {
+			close(b.c)
+		}
+	}
+	return b.c
+}
+
+// publish sends e unless nobody listens or the buffer is full.
+func (b *eventBus) publish(e Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.c == nil || b.closed {
+		return
+	}
+	select {
+	case b.c <- e:
+	default:
+	}
+}
+
+func (b *eventBus) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	if b.c != nil {
+		close(b.c)
+	}
+}
+
+// Events returns the channel of the events of the cache, namespaces
+// included. Every call returns the same channel, so several readers share
+// the events instead of each getting all of them. Events are only recorded
+// once it is called and dropped while the reader lags more than 1024
+// events behind. The channel is closed by Destroy of the root cache.
+func (f *FileCache) Events() <-chan Event {
+	return f.root.events.subscribe()
+}
+
+// emit publishes e, from this cache, to the readers of Events.
+func (f *FileCache) emit(e Event) {
+	e.Namespace, e.Time = f.namespace, time.Now()
+	f.root.events.publish(e)
+}
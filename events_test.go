@@ -0,0 +1,56 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 3}, nil)
+	defer fc.Destroy(ctx)
+	events := fc.Events()
+
+	ns := fc.Namespace("ns")
+	ns.Write(ctx, "key1", sampleReader("ABC"))
+	r, err := ns.Read(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Write(ctx, "key2", sampleReader("ABC"))
+	fc.Delete(ctx, "key2")
+	ns.Write(ctx, "key3", sampleReader("ABC"))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(ns.absFilePath("key1"), old, old)
+	fc.runGC()
+
+	expected := []Event{
+		{Type: EventWritten, Namespace: "ns", Key: "key1", Size: 3, Reason: ReasonNew},
+		{Type: EventRead, Namespace: "ns", Key: "key1", Size: 3, Reason: ReasonCache},
+		{Type: EventWritten, Key: "key2", Size: 3, Reason: ReasonNew},
+		{Type: EventDeleted, Key: "key2", Size: 3, Reason: ReasonDelete},
+		{Type: EventWritten, Namespace: "ns", Key: "key3", Size: 3, Reason: ReasonNew},
+		{Type: EventEvicted, Namespace: "ns", Key: "key1", Size: 3, Reason: ReasonLRU},
+		{Type: EventGC, GC: GCReport{GCResult: GCResult{LRUEvicted: 1, LRUBytesFreed: 3, BytesFreed: 3}, Scanned: 2}},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			got.Time, got.GC.Started, got.GC.Duration = time.Time{}, time.Time{}, 0
+			if got != want {
+				t.Fatalf("unexpected %s event %+v, want %+v", got.Type, got, want)
+			}
+		default:
+			t.Fatalf("missing %s event", want.Type)
+		}
+	}
+
+	fc.Destroy(ctx)
+	if _, ok := <-events; ok {
+		t.Fatal("Destroy must close the events channel")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"log"
 	"time"
 
 	"github.com/mobile-health/filecache"
@@ -16,14 +17,17 @@ func sampleReader(s string) io.Reader {
 func main() {
 	ctx := context.Background()
 
-	fc := filecache.New(filecache.Config{
+	fc, err := filecache.New(filecache.Config{
 		BaseDir:         "filecache",
 		TempDir:         "tmp",
 		MaxTTL:          60 * time.Second,
 		MaxSize:         10 * 1024 * 1024,
 		CleanupInterval: 10 * time.Second,
 	}, nil)
-	defer fc.Empty(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fc.Destroy(ctx)
 
 	fc.RunGC()
 	defer fc.StopGC()
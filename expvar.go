@@ -0,0 +1,36 @@
+package filecache
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// expvarCounters are the counters published by PublishExpvar.
+type expvarCounters struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// PublishExpvar publishes the counters of the cache, its namespaces
+// included, as the expvar name, so /debug/vars shows them: entries, bytes,
+// hits, misses and evictions, as reported by Stats. It fails if name is
+// already published.
+func (f *FileCache) PublishExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats := f.Stats()
+		return expvarCounters{
+			Entries:   stats.Entries,
+			Bytes:     stats.Bytes,
+			Hits:      stats.Hits,
+			Misses:    stats.Misses,
+			Evictions: stats.EvictTTL + stats.EvictSize,
+		}
+	}))
+	return nil
+}
@@ -0,0 +1,39 @@
+package filecache
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.PublishExpvar("filecache_test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.PublishExpvar("filecache_test"); err == nil {
+		t.Fatal("a name must not be published twice")
+	}
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	fc.Namespace("ns").Write(ctx, "key", sampleReader("DEFG"))
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+
+	var counters expvarCounters
+	if err := json.Unmarshal([]byte(expvar.Get("filecache_test").String()), &counters); err != nil {
+		t.Fatal(err)
+	}
+	if counters != (expvarCounters{Entries: 2, Bytes: 7, Hits: 1, Misses: 1}) {
+		t.Fatal("counters must cover the cache and its namespaces", counters)
+	}
+}
@@ -0,0 +1,65 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const fallbackWriteTimeout = 5 * time.Minute
+
+// Store is the minimal set of operations of a cache, which a *FileCache
+// satisfies. It is used to chain a cache to a fallback one.
+type Store interface {
+	Read(ctx context.Context, key string) (io.ReadCloser, error)
+	Write(ctx context.Context, key string, r io.Reader) error
+}
+
+// readFallback reads key from the fallback cache, stores it locally and
+// serves the local copy. missErr is returned if the fallback misses too.
+func (f *FileCache) readFallback(ctx context.Context, key string, missErr error) (io.ReadCloser, error) {
+	r, err := f.Fallback.Read(ctx, key)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			f.Logger.WithError(err).WithField("key", key).Warn("Failed to read from fallback")
+		}
+		return nil, missErr
+	}
+	defer r.Close()
+
+	w, err := f.create(ctx, key, WriteOptions{})
+	if err != nil && !errors.Is(err, ErrKeyExists) {
+		return nil, err
+	}
+	if err == nil {
+		if _, err := io.Copy(w, r); err != nil {
+			w.Abort()
+			return nil, err
+		}
+		if err := w.Close(); err != nil && !errors.Is(err, ErrKeyExists) {
+			return nil, err
+		}
+	}
+	return f.read(ctx, key, !f.DisableTouch)
+}
+
+// writeFallback copies the local entry of key to the fallback cache,
+// failures are only logged.
+func (f *FileCache) writeFallback(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), fallbackWriteTimeout)
+	defer cancel()
+
+	file, err := os.Open(f.absFilePath(key))
+	if err != nil {
+		f.Logger.WithError(err).WithField("key", key).Warn("Failed to write to fallback")
+		return
+	}
+	defer file.Close()
+
+	if err := f.Fallback.Write(ctx, key, file); err != nil && !errors.Is(err, ErrKeyExists) {
+		f.Logger.WithError(err).WithField("key", key).Warn("Failed to write to fallback")
+	}
+}
@@ -0,0 +1,49 @@
+package filecache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFallback(t *testing.T) {
+	ctx := context.Background()
+
+	shared := MustNew(Config{BaseDir: "filecache/shared", TempDir: "tmp"}, nil)
+	defer shared.Empty(ctx)
+	fc := MustNew(Config{BaseDir: "filecache/local", TempDir: "tmp", Fallback: shared}, nil)
+	defer fc.Empty(ctx)
+
+	if err := shared.Write(ctx, "remote", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fc.Read(ctx, "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	r.Close()
+	if buf.String() != "ABC" {
+		t.Fatal("data not match")
+	}
+	if !fc.Has("remote") {
+		t.Fatal("fallback hit must repopulate the local cache")
+	}
+
+	if _, err := fc.Read(ctx, "missing"); err == nil {
+		t.Fatal("must not found")
+	}
+
+	if err := fc.Write(ctx, "local", sampleReader("DEF")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && !shared.Has("local"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !shared.Has("local") {
+		t.Fatal("write must be copied to the fallback")
+	}
+}
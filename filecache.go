@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"io/fs"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -19,12 +24,69 @@ const (
 	defaultMaxTTL          = 4 * time.Hour      // 4 hours
 	defaultBaseDir         = "filecache"
 	defaultCleanupInterval = 5 * time.Minute
+	defaultSizeRescan      = 10 * time.Minute
 	defaultLockKey         = "lock_filecache"
 	defaultDirFileMode     = os.FileMode(0777)
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultGCBatchSize     = 256
+	defaultLogLevel        = logrus.WarnLevel
+	readdirBatchSize       = 1024
+
+	// internalFilePrefix is the name prefix of the files kept next to the
+	// entries by the cache itself, they are never listed as entries.
+	internalFilePrefix = ".filecache"
+	// tempFilePrefix is the name prefix of the temp files of pending writes.
+	tempFilePrefix = internalFilePrefix + "tmp-"
+	// sidecarFilePrefix is the name prefix of the metadata of entries.
+	sidecarFilePrefix = internalFilePrefix + "meta-"
 )
 
 var (
-	errKeyExisted = errors.New("key existed")
+	// ErrKeyExists is returned when writing a key which is already cached.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrKeyNotFound is returned when a key is not in the cache, it matches
+	// fs.ErrNotExist with errors.Is.
+	ErrKeyNotFound = fmt.Errorf("key not found: %w", fs.ErrNotExist)
+
+	// ErrCacheFull is returned by writes which can not make room for their
+	// entry with Config.EvictBeforeWrite, because the entries left are
+	// pinned.
+	ErrCacheFull = errors.New("cache is full")
+
+	// ErrCrossDevice is returned when a temp dir is not on the same
+	// filesystem as the base dir, so files could not be renamed atomically.
+	ErrCrossDevice = errors.New("temp dir is not on the same filesystem as base dir")
+
+	// ErrInvalidKey is returned when a key can not be used as a file name.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrEntryTooLarge is returned when an entry can never fit in the cache.
+	ErrEntryTooLarge = errors.New("entry too large")
+
+	// ErrEntryTooSmall is returned when an entry is smaller than
+	// Config.MinEntrySize.
+	ErrEntryTooSmall = errors.New("entry too small")
+
+	// ErrUnsafePath is returned when the path of a key goes through a
+	// symlink and Config.FollowSymlinks is not set.
+	ErrUnsafePath = errors.New("unsafe path")
+
+	// ErrKeyIsDirectory is returned when the path of a key is a directory,
+	// such as a namespace, so it can neither be read nor written.
+	ErrKeyIsDirectory = errors.New("key is a directory")
+
+	// ErrLowDiskSpace is returned by writes while the filesystem has less
+	// free space than Config.MinFreeSpace.
+	ErrLowDiskSpace = errors.New("low disk space")
+
+	// ErrNotAdmitted is returned by writes of entries which Config.TinyLFU
+	// keeps out of a full cache.
+	ErrNotAdmitted = errors.New("entry not admitted")
+
+	// ErrCommitRejected is returned when Config.CommitValidator rejects a
+	// write.
+	ErrCommitRejected = errors.New("commit rejected")
 )
 
 type Config struct {
@@ -33,13 +95,201 @@ type Config struct {
 	MaxSize         int64
 	MaxTTL          time.Duration
 	CleanupInterval time.Duration
-	LogLevel        logrus.Level
+	// GCJitter delays each scheduled GC run by up to GCJitter, so processes
+	// sharing a cache do not sweep it together.
+	GCJitter time.Duration
+
+	// TTLJitter shifts the TTL of each entry by up to ±TTLJitter, derived
+	// from its key, and must be below MaxTTL. Per-entry TTLs are not jittered.
+	TTLJitter time.Duration
+
+	// GCBatchSize is the number of entries deleted per hold of the global
+	// lock. Defaults to 256.
+	GCBatchSize int
+
+	// GCDeletesPerSecond and GCBytesPerSecond limit the deletion rate of the
+	// GC, zero means no limit.
+	GCDeletesPerSecond int
+	GCBytesPerSecond   int64
+
+	// TempFileMaxAge is the age past which temp files left behind by a
+	// crash are removed. Defaults to 24 hours, negative keeps them.
+	TempFileMaxAge time.Duration
+
+	// QuarantineDir is where Verify moves corrupted entries, on the
+	// filesystem of BaseDir. Defaults to a directory of BaseDir.
+	QuarantineDir string
+
+	// LogLevel defaults to logrus.WarnLevel, Silent discards every log.
+	LogLevel logrus.Level
+	Silent   bool
+
+	// ValidateKey adds rules on keys, its error fails the operation with
+	// ErrInvalidKey.
+	ValidateKey func(key string) error
+
+	// PersistAccessTime records the last access of entries in their sidecar
+	// for the LRU cleaner, at the cost of a sidecar write per read.
+	PersistAccessTime bool
+
+	// PersistAccessCount counts the accesses of entries in their sidecar,
+	// for the LFU policy, at the cost of a sidecar write per read.
+	PersistAccessCount bool
+
+	// DisableTouch makes reads leave the access time of entries untouched,
+	// so entries age from their write.
+	DisableTouch bool
+
+	// LazyExpire makes reads delete and report as missing the entries
+	// which outlived their TTL.
+	LazyExpire bool
+
+	// MaxKeyLength is the length of file names above which keys are stored
+	// under their hash. Zero means no limit.
+	MaxKeyLength int
+
+	// KeyEncoder maps keys to file names, it defaults to EscapedKeys.
+	KeyEncoder KeyEncoder
+
+	// LockNamespace is the key of the global lock and the prefix of the key
+	// locks. Defaults to "lock_filecache".
+	LockNamespace string
+
+	// Hasher creates the hash of the checksums, it defaults to SHA-256.
+	// HashAlgorithm names it and is required with Hasher.
+	Hasher        func() hash.Hash
+	HashAlgorithm string
+
+	// ChecksumWrites records the checksum of every entry written, for
+	// Verify.
+	ChecksumWrites bool
+
+	// MaxServeAge is the age since their write past which entries are never
+	// served. Zero disables it.
+	MaxServeAge time.Duration
+
+	// FollowSymlinks allows keys whose path goes through a symlink.
+	FollowSymlinks bool
+
+	// Fallback is a secondary cache serving local misses and receiving a
+	// copy of the writes.
+	Fallback Store
+
+	// Loader loads the keys missing from the cache and the fallback cache.
+	Loader Loader
+
+	// MaxStale is how long after their expiry entries are still served
+	// while the Loader refreshes them.
+	MaxStale time.Duration
+
+	// RefreshAhead is the fraction of the TTL left, e.g. 0.1, below which
+	// reads refresh entries through the Loader.
+	RefreshAhead float64
+
+	// NegativeTTL is how long keys found missing are reported missing
+	// without checking again. Zero disables it.
+	NegativeTTL time.Duration
+
+	// MaxEntrySize is the largest entry accepted, zero means no limit.
+	MaxEntrySize int64
+
+	// SkipSync commits writes without syncing them, a crash may then leave
+	// entries truncated.
+	SkipSync bool
+
+	// CommitValidator checks the temp file of a write before its commit,
+	// its error fails the write with ErrCommitRejected.
+	CommitValidator func(tempPath string, size int64) error
+
+	// MinEntrySize is the smallest entry accepted, zero means no limit.
+	MinEntrySize int64
+
+	// EvictBeforeWrite makes writes evict entries to fit within MaxSize
+	// before committing.
+	EvictBeforeWrite bool
+
+	// MaxConcurrentWrites bounds the writes in flight, zero means unbounded.
+	MaxConcurrentWrites int
+
+	// OnWrite is called after each commit. Its error is logged, or fails
+	// the write and removes the entry with OnWriteFailsWrite.
+	OnWrite           func(ctx context.Context, key string, size int64) error
+	OnWriteFailsWrite bool
+
+	// OnGCComplete is called after each scheduled GC run with its result
+	// and the size and entry count of the cache.
+	OnGCComplete func(result GCResult, totalSize int64, entryCount int)
+
+	// Hooks observe the entries as they are written, read and removed.
+	Hooks Hooks
+
+	// StatsPrefixes are key prefixes whose hits and misses Stats reports
+	// apart.
+	StatsPrefixes []string
+
+	// GCWriteThreshold runs the GC once this many bytes were written since
+	// the last run. Zero disables it.
+	GCWriteThreshold int64
+
+	// WalkConcurrency is the number of entries stat'ed in parallel when
+	// listing the cache, 0 or 1 lists them serially.
+	WalkConcurrency int
+
+	// Fanout is the number of levels of shard directories, from 0 to 3. It
+	// can only be changed on an empty cache.
+	Fanout int
+
+	// InMemoryIndex keeps the entries indexed in memory, it suits caches
+	// with a single writer process.
+	InMemoryIndex bool
+
+	// SizeScanInterval is how often the size of the cache is recounted
+	// from disk. Defaults to 10 minutes, negative recounts on every Size.
+	SizeScanInterval time.Duration
+
+	// EvictionPolicy picks the entries evicted by the GC, it defaults to
+	// TTLLRU.
+	EvictionPolicy EvictionPolicy
+
+	// MaxEntries is the number of entries over which the GC evicts, zero
+	// means no limit.
+	MaxEntries int
+
+	// MinEvictAge protects entries accessed less than this long ago from
+	// eviction and expiry.
+	MinEvictAge time.Duration
+
+	// HighWatermark and LowWatermark replace MaxSize for the GC, which
+	// evicts down to the low watermark once over the high one.
+	HighWatermark Watermark
+	LowWatermark  Watermark
+
+	// MinFreeSpace is the space kept free on the filesystem of BaseDir.
+	MinFreeSpace Watermark
+
+	// TinyLFU keeps entries out of a full cache unless their key is
+	// accessed more often than the entry they would evict.
+	TinyLFU bool
+
+	// RetryAttempts is how many times a filesystem call failing with a
+	// transient error is attempted. RetryBackoff is the first delay between
+	// attempts, doubling on each, it defaults to 50ms.
+	RetryAttempts int
+	RetryBackoff  time.Duration
 }
 
 type ILock interface {
 	Unlock(ctx context.Context)
 }
 
+// ILockFatory creates the locks of a cache. Keys and the whole cache are
+// locked through the same factory. The global cache key
+// (Config.LockNamespace) is taken by Empty, the GC and the writes making
+// room, which then take the locks of the keys they remove; it is never
+// waited for while a key lock is held. A factory shared by several
+// processes must make a lock on the global key block the key locks of the
+// other processes, so Empty keeps their writes out too, but not those of
+// the process holding it.
 type ILockFatory interface {
 	Lock(ctx context.Context, key string) (ILock, error)
 	Has(ctx context.Context, key string) bool
@@ -49,49 +299,166 @@ type FileCache struct {
 	Config
 	lockFactory ILockFatory
 	quit        chan bool
+	gcCtx       context.Context
+	gcCancel    context.CancelFunc
 	Logger      *logrus.Logger
+
+	// namespace is the path of this cache relative to the root cache,
+	// empty for the root itself.
+	namespace  string
+	root       *FileCache
+	nsMutex    sync.Mutex
+	namespaces map[string]*FileCache
+
+	limitsMutex sync.RWMutex
+	admission   *admission
+	// commitMutex serializes the existence check and the rename of writes,
+	// so concurrent writes of a new key have a single winner even without
+	// a lock factory.
+	commitMutex *sync.Mutex
+	// sidecarMutex serializes the read-modify-write of sidecars.
+	sidecarMutex *sync.Mutex
+	trigger      *gcTrigger
+	evictions    *evictions
+	activity     *activity
+	prefixReads  prefixReads
+	// flights are the fills of GetOrWrite in progress.
+	flights *flights
+	// updates serialize the calls of Update by key.
+	updates   *keyLocks
+	events    *eventBus
+	gcReports *gcReports
+	// instruments observe the operations, see Instrument.
+	instruments *instruments
+	// index is the in-memory index of the entries, nil unless
+	// InMemoryIndex is set.
+	index *index
+	// usage counts the bytes of the entries, see Size.
+	usage *sizeCounter
+	// frequency estimates the access frequency of keys, nil unless
+	// TinyLFU is set.
+	frequency *sketch
+	// misses are the keys recently found missing, nil unless NegativeTTL
+	// is set.
+	misses *tombstones
 }
 
+// mkdirAll is os.MkdirAll, it is replaced in tests.
+var mkdirAll = os.MkdirAll
+
+// ensureDir creates dir and returns its absolute path. Processes starting
+// together may race to create it, and MkdirAll then fails spuriously on
+// some network filesystems; its error is ignored if dir exists anyway.
 func ensureDir(dir string) (string, error) {
 	if absdir, err := filepath.Abs(dir); err != nil {
 		return "", err
 	} else {
 		dir = absdir
 	}
-	if err := os.MkdirAll(dir, os.FileMode(0777)); err != nil {
-		panic(err)
+	if err := mkdirAll(dir, defaultDirFileMode); err != nil {
+		if info, statErr := os.Stat(dir); statErr != nil || !info.IsDir() {
+			return "", err
+		}
 	}
 	return dir, nil
 }
 
-func New(config Config, lockFactory ILockFatory) *FileCache {
+// New creates a cache, creating its directories if needed. It fails on
+// invalid limits or when the directories can not be created.
+func New(config Config, lockFactory ILockFatory) (*FileCache, error) {
 	fc := &FileCache{Config: config, lockFactory: lockFactory, quit: make(chan bool)}
+	fc.root = fc
+	fc.admission = newAdmission(config.MaxConcurrentWrites)
+	fc.commitMutex = &sync.Mutex{}
+	fc.sidecarMutex = &sync.Mutex{}
+	fc.trigger = newGCTrigger()
+	fc.evictions = &evictions{}
+	fc.activity = &activity{}
+	fc.prefixReads = newPrefixReads(config.StatsPrefixes)
+	fc.flights = &flights{}
+	fc.updates = &keyLocks{}
+	fc.events = &eventBus{}
+	fc.gcReports = &gcReports{}
+	fc.instruments = &instruments{}
+	fc.usage = &sizeCounter{}
+	if maxSize, maxTTL, err := resolveLimits(fc.MaxSize, fc.MaxTTL, fc.TTLJitter); err != nil {
+		return nil, err
+	} else {
+		fc.MaxSize, fc.MaxTTL = maxSize, maxTTL
+	}
+	if fc.CleanupInterval < 0 {
+		return nil, fmt.Errorf("invalid cleanup interval %s", fc.CleanupInterval)
+	}
+	if fc.GCJitter < 0 {
+		return nil, fmt.Errorf("invalid GC jitter %s", fc.GCJitter)
+	}
+	if fc.GCBatchSize < 0 {
+		return nil, fmt.Errorf("invalid GC batch size %d", fc.GCBatchSize)
+	}
+	if fc.GCDeletesPerSecond < 0 || fc.GCBytesPerSecond < 0 {
+		return nil, fmt.Errorf("invalid GC rate of %d deletes and %d bytes per second", fc.GCDeletesPerSecond, fc.GCBytesPerSecond)
+	}
+	if err := validateWatermarks(fc.HighWatermark, fc.LowWatermark); err != nil {
+		return nil, err
+	}
+	if err := fc.MinFreeSpace.validate(); err != nil {
+		return nil, err
+	}
+	if fc.Fanout < 0 || fc.Fanout > maxFanout {
+		return nil, fmt.Errorf("fanout %d is not between 0 and %d", fc.Fanout, maxFanout)
+	}
+	if fc.RefreshAhead < 0 || fc.RefreshAhead >= 1 {
+		return nil, fmt.Errorf("refresh ahead %g is not between 0 and 1", fc.RefreshAhead)
+	}
+	if fc.Hasher != nil && len(fc.HashAlgorithm) == 0 {
+		return nil, errors.New("hash algorithm must be named when a hasher is set")
+	}
+	if fc.MaxEntrySize > 0 && fc.MinEntrySize > fc.MaxEntrySize {
+		return nil, fmt.Errorf("min entry size %d is over max entry size %d", fc.MinEntrySize, fc.MaxEntrySize)
+	}
+
 	if len(fc.BaseDir) == 0 {
 		fc.BaseDir = defaultBaseDir
 	}
 	if dir, err := ensureDir(fc.BaseDir); err != nil {
-		panic(err)
+		return nil, err
 	} else {
 		fc.BaseDir = dir
 	}
 
+	if len(fc.QuarantineDir) == 0 {
+		fc.QuarantineDir = filepath.Join(fc.BaseDir, quarantineDirName)
+	}
+
 	if len(fc.TempDir) == 0 {
 		fc.TempDir = os.TempDir()
 	}
 	if dir, err := ensureDir(fc.TempDir); err != nil {
-		panic(err)
+		return nil, err
 	} else {
 		fc.TempDir = dir
 	}
-	if fc.MaxSize == 0 {
-		fc.MaxSize = defaultMaxSize
-	}
-	if fc.MaxTTL == 0 {
-		fc.MaxTTL = defaultMaxTTL
-	}
 	if fc.CleanupInterval == 0 {
 		fc.CleanupInterval = defaultCleanupInterval
 	}
+	if fc.SizeScanInterval == 0 {
+		fc.SizeScanInterval = defaultSizeRescan
+	}
+	if len(fc.LockNamespace) == 0 {
+		fc.LockNamespace = defaultLockKey
+	}
+	if fc.RetryBackoff == 0 {
+		fc.RetryBackoff = defaultRetryBackoff
+	}
+	if fc.GCBatchSize == 0 {
+		fc.GCBatchSize = defaultGCBatchSize
+	}
+	if fc.TempFileMaxAge == 0 {
+		fc.TempFileMaxAge = defaultTempFileMaxAge
+	}
+	if fc.LogLevel == logrus.PanicLevel {
+		fc.LogLevel = defaultLogLevel
+	}
 	fc.Logger = &logrus.Logger{
 		Out:          os.Stderr,
 		Formatter:    new(logrus.TextFormatter),
@@ -100,262 +467,1021 @@ func New(config Config, lockFactory ILockFatory) *FileCache {
 		ExitFunc:     os.Exit,
 		ReportCaller: false,
 	}
+	if fc.Silent {
+		fc.Logger.Out = io.Discard
+	}
+	if fc.TinyLFU {
+		fc.frequency = newSketch()
+	}
+	fc.misses = newTombstones(fc.NegativeTTL)
+	if fc.InMemoryIndex {
+		fc.index = &index{}
+		if err := fc.loadIndex(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	fc.gcCtx, fc.gcCancel = context.WithCancel(context.Background())
+	return fc, nil
+}
+
+// MustNew is like New but panics on error.
+func MustNew(config Config, lockFactory ILockFatory) *FileCache {
+	fc, err := New(config, lockFactory)
+	if err != nil {
+		panic(err)
+	}
 	return fc
 }
 
+// resolveLimits applies the defaults to zero limits and rejects negative
+// ones, and TTLs which ttlJitter could shift to zero or below.
+func resolveLimits(maxSize int64, maxTTL, ttlJitter time.Duration) (int64, time.Duration, error) {
+	if maxSize < 0 {
+		return 0, 0, fmt.Errorf("invalid max size %d", maxSize)
+	}
+	if maxTTL < 0 {
+		return 0, 0, fmt.Errorf("invalid max TTL %s", maxTTL)
+	}
+	if maxSize == 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxTTL == 0 {
+		maxTTL = defaultMaxTTL
+	}
+	if ttlJitter < 0 || ttlJitter >= maxTTL {
+		return 0, 0, fmt.Errorf("TTL jitter %s is not between 0 and max TTL %s", ttlJitter, maxTTL)
+	}
+	return maxSize, maxTTL, nil
+}
+
+// UpdateLimits changes MaxSize and MaxTTL of the cache and its namespaces,
+// the running GC uses the new values from its next run on. Zero values
+// fall back to the defaults like in New.
+func (fc *FileCache) UpdateLimits(maxSize int64, maxTTL time.Duration) error {
+	maxSize, maxTTL, err := resolveLimits(maxSize, maxTTL, fc.TTLJitter)
+	if err != nil {
+		return err
+	}
+	for _, c := range append([]*FileCache{fc}, fc.Namespaces()...) {
+		c.limitsMutex.Lock()
+		c.MaxSize, c.MaxTTL = maxSize, maxTTL
+		c.limitsMutex.Unlock()
+	}
+	return nil
+}
+
+// EffectiveConfig returns the configuration of the cache once the defaults
+// are applied: absolute directories, default limits and log level, and
+// the current limits if they were updated.
+func (fc *FileCache) EffectiveConfig() Config {
+	fc.limitsMutex.RLock()
+	config := fc.Config
+	fc.limitsMutex.RUnlock()
+	config.HashAlgorithm = fc.hashAlgorithm()
+	config.KeyEncoder = fc.keyEncoder()
+	return config
+}
+
+func (fc *FileCache) limits() (int64, time.Duration) {
+	fc.limitsMutex.RLock()
+	defer fc.limitsMutex.RUnlock()
+	return fc.MaxSize, fc.MaxTTL
+}
+
 func checkFileExist(asbFilePath string) error {
 	fs, err := os.Stat(asbFilePath)
 	if err != nil {
 		return err
 	}
 	if fs.IsDir() {
-		return os.ErrNotExist
+		return ErrKeyIsDirectory
 	}
 	return nil
 }
 
-func keylock(key string) string {
-	return fmt.Sprintf("%s_%s", defaultLockKey, key)
+// validateKey rejects keys which would resolve to the base dir itself, to
+// a sub-directory or could be mistaken for internal files or hashed names,
+// then applies Config.ValidateKey.
+func (f *FileCache) validateKey(key string) error {
+	if len(strings.TrimSpace(key)) == 0 || isInternalFile(key) || isHashedName(key) {
+		return ErrInvalidKey
+	}
+	if name := f.fileName(key); !isLocalName(name) || isNestedName(name) || isInternalFile(name) {
+		return ErrInvalidKey
+	}
+	if f.ValidateKey != nil {
+		if err := f.ValidateKey(key); err != nil {
+			return &invalidKeyError{key: key, err: err}
+		}
+	}
+	return nil
+}
+
+// invalidKeyError wraps an error of Config.ValidateKey, it matches both
+// ErrInvalidKey and the wrapped error with errors.Is.
+type invalidKeyError struct {
+	key string
+	err error
+}
+
+func (e *invalidKeyError) Error() string {
+	return fmt.Sprintf("invalid key %q: %v", e.key, e.err)
+}
+
+func (e *invalidKeyError) Is(target error) bool {
+	return target == ErrInvalidKey
+}
+
+func (e *invalidKeyError) Unwrap() error {
+	return e.err
+}
+
+// OpError records the operation and the key of a failed cache operation,
+// like os.PathError does for files. The cause is reachable with errors.Is
+// and errors.As.
+type OpError struct {
+	Op  string
+	Key string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return e.Op + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// opError wraps err in an OpError unless it is nil or already one.
+func opError(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*OpError); ok {
+		return err
+	}
+	return &OpError{Op: op, Key: key, Err: err}
+}
+
+func (f *FileCache) keylock(key string) string {
+	key = f.fileName(key)
+	if len(f.namespace) > 0 {
+		key = f.namespace + "/" + key
+	}
+	return fmt.Sprintf("%s_%s", f.LockNamespace, key)
 }
 
 func (f *FileCache) absFilePath(key string) string {
-	return filepath.Join(f.BaseDir, key)
+	name := f.fileName(key)
+	return filepath.Join(f.entryDir(name), name)
+}
+
+// checkSafePath returns ErrUnsafePath if a component of absFilePath below
+// the root BaseDir is a symlink.
+func (f *FileCache) checkSafePath(absFilePath string) error {
+	if f.FollowSymlinks {
+		return nil
+	}
+	rel, err := filepath.Rel(f.root.BaseDir, absFilePath)
+	if err != nil {
+		return err
+	}
+	p := f.root.BaseDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return ErrUnsafePath
+		}
+	}
+	return nil
 }
 
-func (f *FileCache) hasFile(key string) (string, error) {
+func (f *FileCache) hasFile(ctx context.Context, key string) (string, error) {
 	absFilePath := f.absFilePath(key)
-	if err := checkFileExist(absFilePath); err != nil {
-		return absFilePath, err
+	err := f.retry(ctx, func() error { return checkFileExist(absFilePath) })
+	if errors.Is(err, fs.ErrNotExist) {
+		return absFilePath, ErrKeyNotFound
 	}
-	return absFilePath, nil
+	return absFilePath, err
 }
 
 // Read returns an IO stream of file reader
 func (f *FileCache) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, end := f.startOp(ctx, "read", key)
+	r, size, reason, err := f.readThrough(ctx, key)
+	hit := err == nil && reason == ReasonCache
+	if hit || err == nil || errors.Is(err, ErrKeyNotFound) {
+		f.root.activity.addRead(hit)
+		f.root.prefixReads.addRead(key, hit)
+	}
+	end(OpResult{Bytes: size, Hit: hit, Err: err})
+	return r, opError("read", key, err)
+}
+
+// readThrough reads key from the cache, then from the fallback cache and
+// through the Loader. It returns the size of the entry and where it was
+// read from.
+func (f *FileCache) readThrough(ctx context.Context, key string) (io.ReadCloser, int64, Reason, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, 0, "", err
+	}
+	f.frequency.add(key)
+	if f.misses.has(key) {
+		f.callHook("OnMiss", f.Hooks.OnMiss, key, 0, ReasonNegative)
+		return nil, 0, ReasonNegative, ErrKeyNotFound
+	}
+	reason := ReasonCache
+	r, err := f.read(ctx, key, !f.DisableTouch)
+	if errors.Is(err, ErrKeyNotFound) {
+		f.callHook("OnMiss", f.Hooks.OnMiss, key, 0, ReasonNotFound)
+	}
+	if err != nil && f.Fallback != nil && errors.Is(err, ErrKeyNotFound) {
+		reason = ReasonFallback
+		r, err = f.readFallback(ctx, key, err)
+	}
+	if err != nil && f.Loader != nil && errors.Is(err, ErrKeyNotFound) {
+		reason = ReasonLoader
+		r, err = f.load(ctx, key)
+	}
+	if errors.Is(err, ErrKeyNotFound) {
+		f.misses.add(key)
+		return nil, 0, ReasonNotFound, err
+	}
+	if err != nil {
+		return nil, 0, reason, err
+	}
+	size := readerSize(r)
+	f.callHook("OnHit", f.Hooks.OnHit, key, size, reason)
+	f.emit(Event{Type: EventRead, Key: key, Size: size, Reason: reason})
+	return r, size, reason, nil
+}
+
+// Peek is like Read but does not count as an access: the access time of
+// the entry is not updated, so peeking does not keep it from being evicted
+// by the TTL and LRU cleaners. It never reads from the fallback cache.
+func (f *FileCache) Peek(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, opError("peek", key, err)
+	}
+	r, err := f.read(ctx, key, false)
+	return r, opError("peek", key, err)
+}
+
+func (f *FileCache) read(ctx context.Context, key string, touch bool) (io.ReadCloser, error) {
 	if f.lockFactory != nil {
-		if f.lockFactory.Has(ctx, keylock(key)) {
+		if f.lockFactory.Has(ctx, f.keylock(key)) {
 			return nil, errors.New("has locked")
 		}
 	}
 
-	absFilePath, err := f.hasFile(key)
-	if err != nil {
+	if f.index != nil {
+		if _, ok := f.index.get(f.fileName(key)); !ok {
+			return nil, ErrKeyNotFound
+		}
+	}
+	absFilePath := f.absFilePath(key)
+	if err := f.checkSafePath(absFilePath); err != nil {
 		return nil, err
 	}
 
-	if err := f.touch(key, time.Now()); err != nil {
+	// Open first and stat the handle, so a key deleted concurrently is
+	// either fully read or reported as not found.
+	var file *os.File
+	err := f.retry(ctx, func() (err error) {
+		file, err = os.Open(absFilePath)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
-
-	file, err := os.Open(absFilePath)
+	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrKeyIsDirectory
+	}
+	expired := f.LazyExpire && f.expired(key, info.ModTime())
+	stale := f.staleWindow() > 0 && f.expired(key, info.ModTime())
+	if stale && f.expiredAt(key, info.ModTime(), time.Now().Add(-f.MaxStale)) {
+		expired, stale = true, false
+	}
+	if expired || f.servedTooLate(key, info.ModTime()) {
+		file.Close()
+		if err := f.delete(ctx, key, ReasonTTL); err != nil {
+			f.Logger.WithError(err).WithField("key", key).Debug("Failed to delete expired key")
+		}
+		return nil, ErrKeyNotFound
+	}
+	if stale {
+		// touching would renew the entry even if the refresh fails
+		go f.refresh(key)
+		return file, nil
+	}
+	if f.refreshDue(key, info.ModTime()) {
+		go f.refresh(key)
+	}
+
+	if touch {
+		if err := f.recordAccess(ctx, key, time.Now()); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
 	return file, nil
 }
 
+// TryRead is like Read but reports a missing key with false instead of an
+// error, the error is reserved to actual failures. It saves the extra stat
+// and the race of calling Has before Read.
+func (f *FileCache) TryRead(ctx context.Context, key string) (io.ReadCloser, bool, error) {
+	r, err := f.Read(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+// Has reports whether key is in the cache. A key whose path is a directory
+// is not, Stat tells this case apart with ErrKeyIsDirectory.
 func (f *FileCache) Has(key string) bool {
-	_, err := f.hasFile(key)
+	if err := f.validateKey(key); err != nil {
+		return false
+	}
+	if f.misses.has(key) {
+		return false
+	}
+	if f.index != nil {
+		_, ok := f.index.get(f.fileName(key))
+		return ok
+	}
+	_, err := f.hasFile(context.Background(), key)
 	return err == nil
 }
 
-// Write writes an file to disk
+// WriteOptions customizes a single write.
+type WriteOptions struct {
+	// TempDir is the directory the file is staged in before being renamed
+	// into place. It must already exist and be on the same filesystem as
+	// BaseDir. Defaults to the directory of the entry.
+	TempDir string
+
+	// TTL is the time to live of the entry from its write, overriding
+	// MaxTTL. It is recorded in the sidecar of the entry, reads do not
+	// extend it. Zero means MaxTTL applies.
+	TTL time.Duration
+
+	// ModTime is the modification time of the entry, e.g. the time of its
+	// source when it is replicated, so its TTL and LRU position follow the
+	// source. Defaults to the time of the write.
+	ModTime time.Time
+
+	// Overwrite atomically replaces an existing entry instead of failing
+	// with ErrKeyExists: readers get either the old or the new content.
+	Overwrite bool
+}
+
+// Write writes an file to disk. An empty reader makes a zero-length entry,
+// which is present like any other.
 func (f *FileCache) Write(ctx context.Context, key string, r io.Reader) error {
+	return f.WriteWithOptions(ctx, key, r, WriteOptions{})
+}
+
+// Set writes an file to disk, atomically replacing the existing entry of
+// key if any.
+func (f *FileCache) Set(ctx context.Context, key string, r io.Reader) error {
+	return f.WriteWithOptions(ctx, key, r, WriteOptions{Overwrite: true})
+}
+
+// WriteWithTTL writes an file to disk which expires ttl after the write,
+// whatever MaxTTL.
+func (f *FileCache) WriteWithTTL(ctx context.Context, key string, r io.Reader, ttl time.Duration) error {
+	return f.WriteWithOptions(ctx, key, r, WriteOptions{TTL: ttl})
+}
+
+// WriteAt writes an file to disk with the given modification time, a zero
+// time stands for now.
+func (f *FileCache) WriteAt(ctx context.Context, key string, r io.Reader, modTime time.Time) error {
+	return f.WriteWithOptions(ctx, key, r, WriteOptions{ModTime: modTime})
+}
+
+// WriteWithOptions writes an file to disk using the given options. When ctx
+// is done the copy stops once the data read from r next reaches the temp
+// file, or at the commit, and the temp file is removed. A read of r which
+// blocks is not interrupted, the caller must unblock r to stop it.
+func (f *FileCache) WriteWithOptions(ctx context.Context, key string, r io.Reader, opts WriteOptions) error {
+	ctx, end := f.startOp(ctx, "write", key)
+	n, err := f.write(ctx, key, r, opts)
+	end(OpResult{Bytes: n, Err: err})
+	return opError("write", key, err)
+}
+
+// write writes the entry of key from r and returns its size.
+func (f *FileCache) write(ctx context.Context, key string, r io.Reader, opts WriteOptions) (int64, error) {
+	if size, ok := sizeHint(r); ok {
+		if f.MaxEntrySize > 0 && size > f.MaxEntrySize {
+			return 0, ErrEntryTooLarge
+		}
+		if size < f.MinEntrySize {
+			return 0, ErrEntryTooSmall
+		}
+	}
+	w, err := f.create(ctx, key, opts)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		w.Abort()
+		return n, err
+	}
+	if err := w.Close(); err != nil {
+		return n, err
+	}
+	if f.Fallback != nil {
+		go f.writeFallback(key)
+	}
+	return n, nil
+}
+
+// sizeHint returns the remaining length of readers which know it, such as
+// bytes.Reader, bytes.Buffer, strings.Reader or regular files.
+func sizeHint(r io.Reader) (int64, bool) {
+	if l, ok := r.(interface{ Len() int }); ok {
+		return int64(l.Len()), true
+	}
+	if file, ok := r.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
+// Delete removes the entry of key from the cache.
+func (f *FileCache) Delete(ctx context.Context, key string) error {
+	return f.delete(ctx, key, ReasonDelete)
+}
+
+// delete is Delete, reporting the removal to Hooks.OnEvict with reason.
+func (f *FileCache) delete(ctx context.Context, key string, reason Reason) error {
+	ctx, end := f.startOp(ctx, "delete", key)
+	size, err := f.remove(ctx, key, reason)
+	end(OpResult{Bytes: size, Err: err})
+	return opError("delete", key, err)
+}
+
+// remove removes the entry of key and returns its size.
+func (f *FileCache) remove(ctx context.Context, key string, reason Reason) (int64, error) {
+	if err := f.validateKey(key); err != nil {
+		return 0, err
+	}
 	if f.lockFactory != nil {
-		lock, err := f.lockFactory.Lock(ctx, keylock(key))
+		lock, err := f.lockFactory.Lock(ctx, f.keylock(key))
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer lock.Unlock(ctx)
 	}
 
-	absFilePath, err := f.hasFile(key)
-	if err == nil {
-		return errKeyExisted
+	absFilePath, err := f.hasFile(ctx, key)
+	if err != nil {
+		return 0, err
 	}
-
-	tmp, err := os.CreateTemp(f.TempDir, "filecachetmp-")
+	info, err := os.Stat(absFilePath)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer tmp.Close()
-	defer os.Remove(tmp.Name())
-
-	if _, err := io.Copy(tmp, r); err != nil {
-		return err
+	if err := f.retry(ctx, func() error { return os.Remove(absFilePath) }); err != nil {
+		return 0, err
 	}
-	if err := tmp.Sync(); err != nil {
-		return err
+	f.usage.add(-info.Size(), -1)
+	if reason == ReasonDelete {
+		f.root.activity.addDelete()
 	}
-	if err := os.Rename(tmp.Name(), absFilePath); err != nil {
-		return err
+	f.index.remove(f.fileName(key))
+	err = f.removeSidecar(ctx, key)
+	f.callHook("OnEvict", f.Hooks.OnEvict, key, info.Size(), reason)
+	event := EventEvicted
+	if reason == ReasonDelete {
+		event = EventDeleted
 	}
-	return nil
+	f.emit(Event{Type: event, Key: key, Size: info.Size(), Reason: reason})
+	return info.Size(), err
 }
 
-func (f *FileCache) Delete(ctx context.Context, key string) error {
+// Flush removes every entry of the cache and of its namespaces, the
+// directories are kept so the cache stays usable. It waits for the writes
+// in flight in this process to finish and holds new ones back until the
+// cache is cleared. When ctx is done, Flush stops with some entries left.
+func (f *FileCache) Flush(ctx context.Context) error {
+	// writers wait for the global lock holding their admission, see
+	// Writer.makeRoom, so the gate is taken first
+	if err := f.admission.gate.lock(ctx); err != nil {
+		return err
+	}
+	defer f.admission.gate.unlock()
+
 	if f.lockFactory != nil {
-		lock, err := f.lockFactory.Lock(ctx, keylock(key))
+		lock, err := f.lockFactory.Lock(ctx, f.LockNamespace)
 		if err != nil {
 			return err
 		}
 		defer lock.Unlock(ctx)
 	}
 
-	absFilePath, err := f.hasFile(key)
-	if err != nil {
-		return err
+	return f.flush(ctx)
+}
+
+func (f *FileCache) flush(ctx context.Context) error {
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		dirs, err := c.entryDirs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			if err := removeFiles(ctx, dir, func(name string) bool { return name != namespaceMarker }); err != nil {
+				return err
+			}
+		}
+		c.index.reset(nil)
+		c.usage.reset()
 	}
-	return os.Remove(absFilePath)
+	return nil
 }
 
-func (f *FileCache) Empty(ctx context.Context) error {
+// Destroy removes the directories of the cache, which is no longer usable
+// afterwards. Destroying a namespace only removes its own subtree, the temp
+// dir shared with the root is left untouched. The temp dir is only removed
+// if it was configured, otherwise only the temp files of the cache are
+// removed from the system temp dir. Like Flush, it waits for the writes in
+// flight and stops with some entries left when ctx is done.
+func (f *FileCache) Destroy(ctx context.Context) error {
+	// the gate is taken before the global lock, as in Flush
+	if err := f.admission.gate.lock(ctx); err != nil {
+		return err
+	}
+	defer f.admission.gate.unlock()
+
 	if f.lockFactory != nil {
-		lock, err := f.lockFactory.Lock(ctx, defaultLockKey)
+		lock, err := f.lockFactory.Lock(ctx, f.LockNamespace)
 		if err != nil {
 			return err
 		}
 		defer lock.Unlock(ctx)
 	}
 
-	if err := os.RemoveAll(f.TempDir); err != nil {
+	if err := f.flush(ctx); err != nil {
 		return err
 	}
-	if err := os.RemoveAll(f.BaseDir); err != nil {
+	if f.root == f {
+		f.events.close()
+		if f.TempDir == filepath.Clean(os.TempDir()) {
+			if err := removeFiles(ctx, f.TempDir, isInternalFile); err != nil {
+				return err
+			}
+		} else if err := os.RemoveAll(f.TempDir); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(f.BaseDir)
+}
+
+// Empty removes the cache directories.
+//
+// Deprecated: Use Destroy, or Flush to keep the cache usable.
+func (f *FileCache) Empty(ctx context.Context) error {
+	return f.Destroy(ctx)
+}
+
+// removeFiles removes the files of dir whose name matches, stopping when
+// ctx is done. Sub directories are left untouched.
+func removeFiles(ctx context.Context, dir string, match func(name string) bool) error {
+	d, err := os.Open(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
-	return nil
+	defer d.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := d.Readdir(readdirBatchSize)
+		for _, entry := range entries {
+			if entry.IsDir() || !match(entry.Name()) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
-func (fc FileCache) touch(key string, ts time.Time) error {
+func (fc *FileCache) touch(key string, ts time.Time) error {
 	if ts.IsZero() {
 		ts = time.Now()
 	}
-	return os.Chtimes(fc.absFilePath(key), ts, ts)
+	if err := os.Chtimes(fc.absFilePath(key), ts, ts); err != nil {
+		return err
+	}
+	fc.index.touch(fc.fileName(key), ts)
+	return nil
 }
 
-func byte2MB(b int64) int64 {
-	return b / (1024 * 1024)
+func isInternalFile(name string) bool {
+	return strings.HasPrefix(name, internalFilePrefix)
+}
+
+// sortFiles orders files by modification time at nanosecond resolution,
+// ties are broken by name so the order is deterministic.
+func sortFiles(list []fs.FileInfo) {
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].ModTime(), list[j].ModTime()
+		if ti.Equal(tj) {
+			return list[i].Name() < list[j].Name()
+		}
+		return ti.Before(tj)
+	})
 }
 
 // Files reads the directory named by dirname and returns
 // a list of fs.FileInfo for the directory's contents,
 // sorted by modification time. If an error occurs reading the directory,
 // Files returns no directory entries along with the error.
+// Sub directories, such as namespaces, temp files of pending writes and
+// sidecars are not included.
 func (fc *FileCache) Files() ([]fs.FileInfo, error) {
-	f, err := os.Open(fc.BaseDir)
-	if err != nil {
-		return nil, err
+	return fc.files(context.Background())
+}
+
+// files is like Files but stops reading the directory once ctx is done.
+// The entries are taken from the in-memory index if there is one.
+func (fc *FileCache) files(ctx context.Context) ([]fs.FileInfo, error) {
+	if fc.index != nil {
+		return fc.index.files(), nil
+	}
+	return fc.scanFiles(ctx)
+}
+
+// scanFiles lists the entries from the directories of the cache.
+func (fc *FileCache) scanFiles(ctx context.Context) ([]fs.FileInfo, error) {
+	if fc.WalkConcurrency > 1 {
+		return fc.filesConcurrently(ctx)
 	}
-	list, err := f.Readdir(-1)
-	f.Close()
+	dirs, err := fc.entryDirs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(list, func(i, j int) bool { return list[i].ModTime().Unix() < list[j].ModTime().Unix() })
+	var list []fs.FileInfo
+	for _, dir := range dirs {
+		if list, err = readFiles(ctx, dir, list); err != nil {
+			return nil, err
+		}
+	}
+	sortFiles(list)
 	return list, nil
 }
 
-func (fc *FileCache) cleanCachedFileByTTL(ctx context.Context) error {
-	files, err := fc.Files()
+// readFiles appends the entries of dir to list.
+func readFiles(ctx context.Context, dir string, list []fs.FileInfo) ([]fs.FileInfo, error) {
+	f, err := os.Open(dir)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	defer f.Close()
 
-	count := 0
-	for _, file := range files {
-		ttl := time.Since(file.ModTime())
-		if ttl > fc.MaxTTL {
-			if err := fc.Delete(ctx, file.Name()); err != nil {
-				return err
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entries, err := f.Readdir(readdirBatchSize)
+		for _, entry := range entries {
+			if !entry.IsDir() && !isInternalFile(entry.Name()) {
+				list = append(list, entry)
 			}
-			count++
-			fc.Logger.WithField("strategy", "TTL").Debugf("Cleaned cache file %s", file.Name())
+		}
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
-	fc.Logger.WithField("strategy", "TTL").Infof("Cleaned %v files", count)
-	return nil
 }
 
-func (fc *FileCache) Size() (int64, error) {
-	var size int64
-	err := filepath.Walk(fc.BaseDir, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// expired reports whether the entry of key modified at modTime has
+// outlived its TTL, its own one if it was written with one. Pinned entries
+// never expire.
+func (fc *FileCache) expired(key string, modTime time.Time) bool {
+	return fc.expiredAt(key, modTime, time.Now())
+}
+
+// expiredAt is expired as of t.
+func (fc *FileCache) expiredAt(key string, modTime time.Time, t time.Time) bool {
+	if sc, err := fc.readSidecar(key); err == nil {
+		if sc.Pinned {
+			return false
 		}
-		if !info.IsDir() {
-			size += info.Size()
+		if sc.ExpiresAt > 0 {
+			return sc.expiredAt(t)
 		}
-		return err
-	})
-	return size, err
+	}
+	_, maxTTL := fc.limits()
+	return t.Sub(modTime) > fc.jitterTTL(key, maxTTL)
+}
+
+func (fc *FileCache) expiredAfter(key string, modTime time.Time, maxTTL time.Duration) bool {
+	return time.Since(modTime) > fc.jitterTTL(key, maxTTL)
+}
+
+// servedTooLate reports whether the entry of key modified at modTime is
+// older than MaxServeAge.
+func (fc *FileCache) servedTooLate(key string, modTime time.Time) bool {
+	if fc.MaxServeAge <= 0 {
+		return false
+	}
+	writtenAt := modTime
+	if sc, err := fc.readSidecar(key); err == nil && sc.WrittenAt > 0 {
+		writtenAt = time.Unix(0, sc.WrittenAt)
+	}
+	return time.Since(writtenAt) > fc.MaxServeAge
+}
+
+// jitterTTL shifts ttl by a deterministic offset of key within
+// [-TTLJitter, TTLJitter].
+func (fc *FileCache) jitterTTL(key string, ttl time.Duration) time.Duration {
+	if fc.TTLJitter <= 0 {
+		return ttl
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	offset := time.Duration(h.Sum64()%uint64(2*fc.TTLJitter+1)) - fc.TTLJitter
+	return ttl + offset
+}
+
+// GCResult summarizes what a GC run has cleaned.
+type GCResult struct {
+	TTLEvicted int
+	LRUEvicted int
+	// TTLBytesFreed and LRUBytesFreed are the bytes freed by each cleaner,
+	// BytesFreed is their sum.
+	TTLBytesFreed int64
+	LRUBytesFreed int64
+	BytesFreed    int64
+}
 
+// cleanCachedFileByTTL deletes the entries which outlived their TTL and
+// returns how many were deleted and the bytes they freed, also when it
+// fails part way.
+func (fc *FileCache) cleanCachedFileByTTL(ctx context.Context) (int, int64, error) {
+	result, _, err := fc.evict(ctx, ttlOnly{}, fc.newGCThrottle())
+	return result.TTLEvicted, result.TTLBytesFreed, err
 }
 
-func (fc *FileCache) cleanCachedFileByLRU(ctx context.Context) error {
-	curSize, err := fc.Size()
+// Keys returns the keys of the cache, ordered by modification time.
+func (fc *FileCache) Keys() ([]string, error) {
+	files, err := fc.Files()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	resize := curSize - fc.MaxSize
-	if resize > 0 {
-		files, err := fc.Files()
-		if err != nil {
-			return nil
-		}
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, fc.entryKey(file.Name()))
+	}
+	return keys, nil
+}
 
-		cleanedSize := int64(0)
-		for _, file := range files {
-			if err := fc.Delete(ctx, file.Name()); err != nil {
-				return err
-			} else {
-				fc.Logger.WithField("strategy", "LRU").Debugf("Cleaned cached file %s", file.Name())
+// cleanCachedFileByLRU evicts the least recently used entries until the
+// cache fits within MaxSize, and returns how many were evicted and the
+// bytes they freed.
+func (fc *FileCache) cleanCachedFileByLRU(ctx context.Context) (lruEvicted int, bytesFreed int64, err error) {
+	return fc.evictLRU(ctx, 0, "")
+}
 
-				cleanedSize += file.Size()
-				if cleanedSize >= resize {
-					break
-				}
-			}
+// evictLRU evicts the least recently used entries until reserve more bytes
+// fit within MaxSize. The entry of skip, if any, is about to be replaced so
+// it is neither counted nor evicted.
+func (fc *FileCache) evictLRU(ctx context.Context, reserve int64, skip string) (lruEvicted int, bytesFreed int64, err error) {
+	maxSize, _ := fc.limits()
+	if size, err := fc.size(ctx); err != nil {
+		return 0, 0, err
+	} else if size+reserve <= maxSize {
+		return 0, 0, nil
+	}
+	files, err := fc.files(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var curSize int64
+	for _, file := range files {
+		if file.Name() != skip {
+			curSize += file.Size()
 		}
-		fc.Logger.WithField("strategy", "LRU").Infof("Cleaned %v(MB) cached files", byte2MB(cleanedSize))
 	}
-	return nil
-}
+	resize := curSize + reserve - maxSize
+	if resize <= 0 {
+		return 0, 0, nil
+	}
+	defer func() { fc.root.evictions.addLRU(lruEvicted, bytesFreed) }()
 
-func (fc *FileCache) cleanCachedFiles(ctx context.Context) error {
-	fc.Logger.Info("Start clearning cached files")
+	if fc.PersistAccessTime {
+		fc.sortByAccessTime(files)
+	}
+	for _, file := range files {
+		if bytesFreed >= resize {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return lruEvicted, bytesFreed, err
+		}
+		if file.Name() == skip || fc.tooYoung(file, time.Now()) || fc.pinned(file.Name()) {
+			continue
+		}
+		if err := fc.delete(ctx, fc.nameKey(file.Name()), ReasonLRU); err != nil {
+			return lruEvicted, bytesFreed, err
+		}
+		lruEvicted++
+		bytesFreed += file.Size()
+		fc.Logger.WithField("strategy", "LRU").Debugf("Cleaned cache file %s", file.Name())
+	}
+	fc.Logger.WithField("strategy", "LRU").Infof("Cleaned %d files, %d bytes", lruEvicted, bytesFreed)
+	if bytesFreed < resize && reserve > 0 {
+		return lruEvicted, bytesFreed, ErrCacheFull
+	}
+	if bytesFreed < resize {
+		fc.Logger.WithField("strategy", "LRU").Warnf("Cache is still over its max size by %d bytes, the remaining entries are pinned or too young", resize-bytesFreed)
+	}
+	return lruEvicted, bytesFreed, nil
+}
 
+// makeRoom evicts entries so an entry of size bytes for key fits within
+// MaxSize, holding the global lock. Like the GC, it takes the locks of the
+// evicted keys under the global lock, so it must not be called holding a
+// key lock.
+func (fc *FileCache) makeRoom(ctx context.Context, key string, size int64) error {
+	maxSize, _ := fc.limits()
+	if size > maxSize {
+		return ErrEntryTooLarge
+	}
 	if fc.lockFactory != nil {
-		lock, err := fc.lockFactory.Lock(ctx, defaultLockKey)
+		lock, err := fc.lockFactory.Lock(ctx, fc.LockNamespace)
 		if err != nil {
 			return err
 		}
 		defer lock.Unlock(ctx)
 	}
+	_, _, err := fc.evictLRU(ctx, size, fc.fileName(key))
+	return err
+}
 
-	if err := fc.cleanCachedFileByTTL(ctx); err != nil {
-		return err
+// cleanCachedFiles runs the cleaners over the cache and its namespaces.
+// When ctx is done the run is aborted and the result accumulated so far is
+// returned along with the context error.
+func (fc *FileCache) cleanCachedFiles(ctx context.Context) (GCResult, error) {
+	report := fc.clean(ctx)
+	return report.GCResult, report.Err
+}
+
+// CleanNow runs the GC over the cache and its namespaces right away, e.g.
+// to make room before a large download, and returns its report. It waits
+// for a run in progress in another process to finish. The error of the
+// run is both returned and in the report.
+func (fc *FileCache) CleanNow(ctx context.Context) (GCReport, error) {
+	report := fc.clean(ctx)
+	return report, report.Err
+}
+
+// clean is cleanCachedFiles, it returns the report of the run, which is
+// recorded as the last one. The namespaces left on disk by previous
+// processes are opened first, so they are swept too.
+func (fc *FileCache) clean(ctx context.Context) (report GCReport) {
+	ctx, end := fc.startOp(ctx, "gc", "")
+	report.Started = time.Now()
+	defer func() {
+		report.Duration = time.Since(report.Started)
+		fc.recordGC(report)
+		end(OpResult{Bytes: report.BytesFreed, Err: report.Err})
+	}()
+
+	fc.Logger.Info("Start clearning cached files")
+
+	if err := fc.discoverNamespaces(ctx); err != nil {
+		fc.Logger.WithError(err).Warn("Failed to discover namespaces")
+	}
+	throttle := fc.newGCThrottle()
+	for _, c := range append([]*FileCache{fc}, fc.Namespaces()...) {
+		r, scanned, err := c.evict(ctx, c.evictionPolicy(), throttle)
+		report.Scanned += scanned
+		report.TTLEvicted += r.TTLEvicted
+		report.TTLBytesFreed += r.TTLBytesFreed
+		report.LRUEvicted += r.LRUEvicted
+		report.LRUBytesFreed += r.LRUBytesFreed
+		report.BytesFreed += r.BytesFreed
+		if err != nil {
+			report.Err = err
+			return report
+		}
 	}
+	return report
+}
 
-	if err := fc.cleanCachedFileByLRU(ctx); err != nil {
-		return err
+// notifyGCComplete reports the result and the current usage of the cache
+// to Config.OnGCComplete.
+func (fc *FileCache) notifyGCComplete(ctx context.Context, result GCResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			fc.Logger.Errorf("Recovered from panic in OnGCComplete: %v", r)
+		}
+	}()
+
+	totalSize, entryCount, err := fc.totalUsage(ctx)
+	if err != nil {
+		fc.Logger.WithError(err).Warn("Failed to compute cache usage")
+		return
 	}
-	return nil
+	fc.OnGCComplete(result, totalSize, entryCount)
+}
+
+// totalUsage returns the size and the number of entries of the cache and
+// its namespaces.
+func (fc *FileCache) totalUsage(ctx context.Context) (int64, int, error) {
+	var totalSize int64
+	var entryCount int
+	for _, c := range append([]*FileCache{fc}, fc.Namespaces()...) {
+		files, err := c.files(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, file := range files {
+			totalSize += file.Size()
+		}
+		entryCount += len(files)
+	}
+	return totalSize, entryCount, nil
 }
 
-// RunGC runs GC to clean old files
+// RunGC runs GC to clean old files. It starts by removing the temp files
+// older than TempFileMaxAge, then a first run is done right away, so a
+// cache restarted over its limits is trimmed without waiting for the
+// cleanup interval, then one run happens per CleanupInterval, delayed by up
+// to GCJitter, and whenever GCWriteThreshold is crossed. A run outlasting
+// the interval is followed by a single catch-up run rather than by one per
+// missed interval. The GC of a root cache also sweeps all of its
+// namespaces, so it should not be started on a namespace.
 func (fc *FileCache) RunGC() {
 	go func() {
-		ticker := time.NewTicker(fc.CleanupInterval)
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		if _, err := fc.removeStaleTemps(fc.gcCtx); err != nil {
+			fc.Logger.WithError(err).Warn("Failed to remove stale temp files")
+		}
+		fc.runGC()
+		next := time.Now().Add(fc.CleanupInterval)
+		timer := time.NewTimer(fc.gcDelay(next, time.Now(), rng))
+		defer timer.Stop()
 		for {
-			<-ticker.C
 			select {
-			case <-ticker.C:
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-				if err := fc.cleanCachedFiles(ctx); err != nil {
-					fc.Logger.WithError(err).Warn("Failed to clean cached files")
+			case <-timer.C:
+				fc.runGC()
+				now := time.Now()
+				if next = next.Add(fc.CleanupInterval); next.Before(now) {
+					next = now
 				}
-				cancel()
+				timer.Reset(fc.gcDelay(next, now, rng))
+			case <-fc.trigger.c:
+				fc.runGC()
 			case <-fc.quit:
 				return
 			}
@@ -363,7 +1489,36 @@ func (fc *FileCache) RunGC() {
 	}()
 }
 
-// RunGC stops running GC
+// gcDelay returns how long to wait at now for the scheduled run of next,
+// with a random jitter of up to GCJitter drawn from rng.
+func (fc *FileCache) gcDelay(next, now time.Time, rng *rand.Rand) time.Duration {
+	delay := next.Sub(now)
+	if fc.GCJitter > 0 {
+		delay += time.Duration(rng.Int63n(int64(fc.GCJitter) + 1))
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// runGC runs a scheduled GC pass.
+func (fc *FileCache) runGC() {
+	ctx, cancel := context.WithTimeout(fc.gcCtx, 5*time.Minute)
+	defer cancel()
+
+	fc.trigger.reset()
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		fc.Logger.WithError(err).Warn("Failed to clean cached files")
+	}
+	if fc.OnGCComplete != nil {
+		fc.notifyGCComplete(ctx, result)
+	}
+}
+
+// StopGC stops running GC, a sweep in progress is cancelled.
 func (fc *FileCache) StopGC() {
+	fc.gcCancel()
 	close(fc.quit)
 }
@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 func sampleReader(s string) io.Reader {
@@ -26,7 +32,7 @@ func existDir(dir string) bool {
 func TestWriteReadEmpty(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, nil)
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
@@ -58,7 +64,7 @@ func TestWriteReadEmpty(t *testing.T) {
 func TestWrite(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, nil)
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
@@ -70,6 +76,28 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestSet(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Set(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Set(ctx, "key", sampleReader("DEF")); err != nil {
+		t.Fatal("set must replace the existing entry", err)
+	}
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "DEF" {
+		t.Fatal("data not match", string(data))
+	}
+}
+
 func getModTime(path string) (time.Time, error) {
 	fs, err := os.Stat(path)
 	if err != nil {
@@ -81,7 +109,7 @@ func getModTime(path string) (time.Time, error) {
 func TestRead(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, nil)
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
@@ -112,7 +140,7 @@ func TestRead(t *testing.T) {
 func TestFiles(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, nil)
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key1", sampleReader("ABC2")); err != nil {
@@ -149,7 +177,7 @@ func TestFiles(t *testing.T) {
 func TestDelete(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, nil)
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
 	defer fc.Empty(ctx)
 
 	fc.Write(ctx, "key1", sampleReader("ABC1"))
@@ -205,7 +233,7 @@ func TestLocker(t *testing.T) {
 	lockFactory := &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}}
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp"}, lockFactory)
+	fc := MustNew(Config{TempDir: "tmp"}, lockFactory)
 	defer fc.Empty(ctx)
 
 	if _, err := fc.lockFactory.Lock(ctx, "key1"); err != nil {
@@ -216,10 +244,30 @@ func TestLocker(t *testing.T) {
 	}
 }
 
+func TestLockNamespace(t *testing.T) {
+	lockFactory := &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}}
+	ctx := context.Background()
+
+	fc1 := MustNew(Config{BaseDir: "filecache1", TempDir: "tmp", LockNamespace: "cache1"}, lockFactory)
+	defer fc1.Destroy(ctx)
+	fc2 := MustNew(Config{BaseDir: "filecache2", TempDir: "tmp", LockNamespace: "cache2"}, lockFactory)
+	defer fc2.Destroy(ctx)
+
+	if _, err := lockFactory.Lock(ctx, "cache1_key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc1.Write(ctx, "key", sampleReader("ABC")); err == nil {
+		t.Fatal("key lock must use the lock namespace")
+	}
+	if err := fc2.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal("key locks of distinct caches must not collide", err)
+	}
+}
+
 func TestCleanCachedFileByTTL(t *testing.T) {
 	ctx := context.Background()
 
-	fc := New(Config{TempDir: "tmp", MaxTTL: 1 * time.Second}, nil)
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: 1 * time.Second}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key1", sampleReader("ABC1")); err != nil {
@@ -232,9 +280,12 @@ func TestCleanCachedFileByTTL(t *testing.T) {
 	if err := fc.Write(ctx, "key3", sampleReader("ABC3")); err != nil {
 		t.Fatal(err)
 	}
-	if err := fc.cleanCachedFileByTTL(ctx); err != nil {
+	if evicted, freed, err := fc.cleanCachedFileByTTL(ctx); err != nil {
 		t.Fatal(err)
 	} else {
+		if evicted != 2 || freed != 8 {
+			t.Fatal("must report the cleaned files", evicted, freed)
+		}
 		files, err := fc.Files()
 		if err != nil {
 			t.Fatal(err)
@@ -248,12 +299,26 @@ func TestCleanCachedFileByTTL(t *testing.T) {
 	}
 }
 
+func TestCleanCachedFileByTTLError(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := os.RemoveAll(fc.BaseDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fc.cleanCachedFileByTTL(ctx); err == nil {
+		t.Fatal("failure to list files must surface")
+	}
+}
+
 func TestCleanCachedFileByLRU(t *testing.T) {
 	ctx := context.Background()
 	data := "bytesample"
 	size := len(data)
 
-	fc := New(Config{TempDir: "tmp", MaxSize: int64(size)*2 - 1}, nil)
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(size)*2 - 1}, nil)
 	defer fc.Empty(ctx)
 
 	if err := fc.Write(ctx, "key1", sampleReader(data)); err != nil {
@@ -268,7 +333,7 @@ func TestCleanCachedFileByLRU(t *testing.T) {
 	fc.touch("key1", time.Now().Add(-time.Minute))
 	fc.touch("key3", time.Now().Add(-time.Minute))
 
-	if err := fc.cleanCachedFileByLRU(ctx); err != nil {
+	if _, _, err := fc.cleanCachedFileByLRU(ctx); err != nil {
 		t.Fatal(err)
 	} else {
 		files, err := fc.Files()
@@ -283,3 +348,908 @@ func TestCleanCachedFileByLRU(t *testing.T) {
 		}
 	}
 }
+
+func TestFilesTieBreak(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	ts := time.Now().Add(-time.Minute)
+	for _, key := range []string{"c", "a", "b"} {
+		if err := fc.Write(ctx, key, sampleReader(key)); err != nil {
+			t.Fatal(err)
+		}
+		fc.touch(key, ts)
+	}
+	fc.touch("c", ts.Add(-time.Millisecond))
+
+	keys, err := fc.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[0] != "c" || keys[1] != "a" || keys[2] != "b" {
+		t.Fatal("must ordered by nanosecond mod time then by name", keys)
+	}
+}
+
+func TestWriteWithTempDir(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	tenantDir, err := ensureDir("tmp/tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.WriteWithOptions(ctx, "key", sampleReader("ABC"), WriteOptions{TempDir: tenantDir}); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("key") {
+		t.Fatal("key must be written")
+	}
+
+	if err := fc.WriteWithOptions(ctx, "key2", sampleReader("ABC"), WriteOptions{TempDir: "tmp/missing"}); err == nil {
+		t.Fatal("must fail on missing temp dir")
+	}
+}
+
+func TestCleanCachedFilesCancel(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Minute}, nil)
+	defer fc.Empty(ctx)
+
+	for _, key := range []string{"key1", "key2"} {
+		if err := fc.Write(ctx, key, sampleReader("ABC")); err != nil {
+			t.Fatal(err)
+		}
+		fc.touch(key, time.Now().Add(-time.Hour))
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	result, err := fc.cleanCachedFiles(cctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("must be cancelled", err)
+	}
+	if result.TTLEvicted != 0 || !fc.Has("key1") || !fc.Has("key2") {
+		t.Fatal("cancelled GC must not evict")
+	}
+
+	result, err = fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TTLEvicted != 2 || result.BytesFreed != 6 {
+		t.Fatal("must report evicted files", result)
+	}
+}
+
+func TestUpdateLimits(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	thumbs := fc.Namespace("thumbs")
+	if err := fc.UpdateLimits(1024, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if maxSize, maxTTL := thumbs.limits(); maxSize != 1024 || maxTTL != time.Minute {
+		t.Fatal("limits must be updated on namespaces")
+	}
+
+	if err := fc.UpdateLimits(-1, time.Minute); err == nil {
+		t.Fatal("must reject negative size")
+	}
+	if err := fc.UpdateLimits(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if maxSize, maxTTL := fc.limits(); maxSize != defaultMaxSize || maxTTL != defaultMaxTTL {
+		t.Fatal("zero limits must fall back to defaults")
+	}
+
+	// namespaces opened while the limits change copy them under the lock,
+	// run with -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			fc.UpdateLimits(int64(1024+i), time.Minute)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		fc.Namespace(fmt.Sprintf("ns%d", i))
+	}
+	<-done
+}
+
+func TestDefaultLogLevel(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if fc.Logger.Level != logrus.WarnLevel {
+		t.Fatal("default log level must be warn", fc.Logger.Level)
+	}
+
+	fc = MustNew(Config{TempDir: "tmp", LogLevel: logrus.DebugLevel}, nil)
+	if fc.Logger.Level != logrus.DebugLevel {
+		t.Fatal("log level must be respected", fc.Logger.Level)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	for _, key := range []string{"", "  ", "\t"} {
+		if err := fc.Write(ctx, key, sampleReader("ABC")); !errors.Is(err, ErrInvalidKey) {
+			t.Fatal("write must reject invalid key", err)
+		}
+		if _, err := fc.Read(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatal("read must reject invalid key", err)
+		}
+		if err := fc.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatal("delete must reject invalid key", err)
+		}
+		if _, err := fc.Stat(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatal("stat must reject invalid key", err)
+		}
+		if fc.Has(key) {
+			t.Fatal("has must reject invalid key")
+		}
+	}
+	if !existDir(fc.BaseDir) {
+		t.Fatal("base dir must be kept")
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, TTLJitter: 10 * time.Minute}, nil)
+	defer fc.Empty(ctx)
+
+	spread := map[time.Duration]bool{}
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		ttl := fc.jitterTTL(key, time.Hour)
+		if ttl < 50*time.Minute || ttl > 70*time.Minute {
+			t.Fatal("jittered TTL out of bounds", ttl)
+		}
+		if ttl != fc.jitterTTL(key, time.Hour) {
+			t.Fatal("jittered TTL must be deterministic")
+		}
+		spread[ttl] = true
+	}
+	if len(spread) < 2 {
+		t.Fatal("jittered TTLs must be spread")
+	}
+
+	for _, jitter := range []time.Duration{-time.Minute, time.Hour} {
+		if _, err := New(Config{TempDir: "tmp", MaxTTL: time.Hour, TTLJitter: jitter}, nil); err == nil {
+			t.Fatal("TTL jitter must be between 0 and MaxTTL", jitter)
+		}
+	}
+	if err := fc.UpdateLimits(0, 10*time.Minute); err == nil {
+		t.Fatal("MaxTTL must stay over the TTL jitter")
+	}
+}
+
+func TestTTLJitterHashedKey(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, TTLJitter: 10 * time.Minute, MaxKeyLength: 64}, nil)
+	defer fc.Empty(ctx)
+
+	key := strings.Repeat("k", 100)
+	ttl, nameTTL := fc.jitterTTL(key, time.Hour), fc.jitterTTL(hashName(key), time.Hour)
+	if ttl == nameTTL {
+		t.Skip("the key and its file name have the same jitter")
+	}
+	// between the TTLs jittered by the key and by the file name
+	age := (ttl + nameTTL) / 2
+	fc.Write(ctx, key, sampleReader("ABC"))
+	fc.touch(key, time.Now().Add(-age))
+
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired := age > ttl; (result.TTLEvicted == 1) != expired || fc.expired(key, time.Now().Add(-age)) != expired {
+		t.Fatal("the GC must jitter the TTL of the key like reads do", ttl, nameTTL, result)
+	}
+}
+
+func TestSymlinkRejected(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", KeyEncoder: RawKeys}, nil)
+	defer fc.Empty(ctx)
+
+	outside := filepath.Join(fc.TempDir, "outside")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, fc.absFilePath("link")); err != nil {
+		t.Skip("symlinks are not supported", err)
+	}
+	if err := os.Symlink(fc.TempDir, fc.absFilePath("linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fc.Read(ctx, "link"); !errors.Is(err, ErrUnsafePath) {
+		t.Fatal("read through a symlink must be rejected", err)
+	}
+	if err := fc.Namespace("linkdir").Write(ctx, "key", sampleReader("ABC")); !errors.Is(err, ErrUnsafePath) {
+		t.Fatal("write through a symlink must be rejected", err)
+	}
+
+	fc.FollowSymlinks = true
+	if _, err := fc.Read(ctx, "link"); err != nil {
+		t.Fatal("symlinks must be followed when allowed", err)
+	}
+}
+
+func TestOnGCComplete(t *testing.T) {
+	ctx := context.Background()
+
+	var got GCResult
+	var gotSize int64
+	var gotCount int
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Minute, OnGCComplete: func(result GCResult, totalSize int64, entryCount int) {
+		got, gotSize, gotCount = result, totalSize, entryCount
+		panic("must be recovered")
+	}}, nil)
+	defer fc.Empty(ctx)
+
+	fc.Write(ctx, "key1", sampleReader("ABC"))
+	fc.Namespace("thumbs").Write(ctx, "key2", sampleReader("ABCD"))
+	fc.Write(ctx, "old", sampleReader("ABC"))
+	fc.touch("old", time.Now().Add(-time.Hour))
+
+	result, _ := fc.cleanCachedFiles(ctx)
+	fc.notifyGCComplete(ctx, result)
+	if got.TTLEvicted != 1 || gotSize != 7 || gotCount != 2 {
+		t.Fatal("must report the usage after GC", got, gotSize, gotCount)
+	}
+}
+
+func TestTryRead(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if r, ok, err := fc.TryRead(ctx, "key"); r != nil || ok || err != nil {
+		t.Fatal("miss must not be an error", err)
+	}
+	if _, err := fc.Read(ctx, "key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("read must return ErrKeyNotFound", err)
+	}
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	r, ok, err := fc.TryRead(ctx, "key")
+	if err != nil || !ok {
+		t.Fatal("must hit", err)
+	}
+	r.Close()
+}
+
+func TestValidateKeyHook(t *testing.T) {
+	ctx := context.Background()
+
+	errTooLong := errors.New("too long")
+	fc := MustNew(Config{TempDir: "tmp", ValidateKey: func(key string) error {
+		if len(key) > 4 {
+			return errTooLong
+		}
+		return nil
+	}}, nil)
+	defer fc.Empty(ctx)
+
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	err := fc.Write(ctx, "longkey", sampleReader("ABC"))
+	if !errors.Is(err, ErrInvalidKey) || !errors.Is(err, errTooLong) {
+		t.Fatal("must wrap the hook error in ErrInvalidKey", err)
+	}
+	if _, err := fc.Read(ctx, " "); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal("built-in checks must still apply", err)
+	}
+}
+
+func TestEmptyConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	data := strings.Repeat("ABC", 1024)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				fc.Write(ctx, fmt.Sprintf("key%d-%d", i, j), sampleReader(data))
+			}
+		}(i)
+	}
+	time.Sleep(time.Millisecond)
+	if err := fc.Empty(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	files, _ := fc.Files()
+	for _, file := range files {
+		if file.Size() != int64(len(data)) {
+			t.Fatal("partial entry survived", file.Name(), file.Size())
+		}
+	}
+}
+
+func TestWriteDeadlineWhileFlushPending(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	w, err := fc.Create(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushed := make(chan error)
+	go func() { flushed <- fc.Flush(ctx) }()
+	for pending := false; !pending; {
+		time.Sleep(time.Millisecond)
+		fc.admission.gate.mutex.Lock()
+		pending = fc.admission.gate.closed != nil
+		fc.admission.gate.mutex.Unlock()
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := fc.Write(tctx, "key2", sampleReader("ABC")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("writes waiting for a flush must honor their context", err)
+	}
+	w.Abort()
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Write(ctx, "key2", sampleReader("ABC")); err != nil {
+		t.Fatal("writes must be admitted after a flush", err)
+	}
+}
+
+func TestLazyExpire(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Minute}, nil)
+	defer fc.Empty(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	fc.touch("key", time.Now().Add(-time.Hour))
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal("expired entries must be served until GC by default", err)
+	}
+	r.Close()
+
+	fc.LazyExpire = true
+	fc.touch("key", time.Now().Add(-time.Hour))
+	if _, err := fc.Read(ctx, "key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("expired entry must not be served", err)
+	}
+	if fc.Has("key") {
+		t.Fatal("expired entry must be deleted")
+	}
+}
+
+func TestEvictBeforeWrite(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)) * 2, EvictBeforeWrite: true}, nil)
+	defer fc.Empty(ctx)
+
+	fc.Write(ctx, "key1", sampleReader(data))
+	fc.Write(ctx, "key2", sampleReader(data))
+	fc.touch("key1", time.Now().Add(-time.Minute))
+
+	if err := fc.Write(ctx, "key3", sampleReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key1") || !fc.Has("key2") || !fc.Has("key3") {
+		t.Fatal("least recently used entry must be evicted before the write")
+	}
+
+	if err := fc.Write(ctx, "huge", sampleReader(strings.Repeat(data, 3))); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatal("entry larger than MaxSize must be rejected", err)
+	}
+	if !fc.Has("key2") || !fc.Has("key3") {
+		t.Fatal("rejected entry must not evict anything")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	old := time.Now().Add(-time.Hour)
+	fc.touch("key", old)
+
+	r, err := fc.Peek(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "ABC" {
+		t.Fatal("data not match")
+	}
+	if info, _ := fc.Stat(ctx, "key"); !info.ModTime.Equal(old) {
+		t.Fatal("peek must not update the access time")
+	}
+}
+
+func TestFlushDestroy(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	thumbs := fc.Namespace("thumbs")
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	fc.SetMeta(ctx, "key", map[string]string{"etag": "1"})
+	thumbs.Write(ctx, "key", sampleReader("ABC"))
+
+	if err := fc.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key") || thumbs.Has("key") {
+		t.Fatal("flush must remove every entry")
+	}
+	if entries, _ := os.ReadDir(fc.BaseDir); len(entries) != 1 {
+		t.Fatal("flush must only keep the namespace dirs", entries)
+	}
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal("cache must be usable after flush", err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := fc.Destroy(cctx); !errors.Is(err, context.Canceled) {
+		t.Fatal("destroy must honor its context", err)
+	}
+	if err := fc.Destroy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if existDir(fc.BaseDir) || existDir(fc.TempDir) {
+		t.Fatal("destroy must remove the directories")
+	}
+}
+
+func TestRunGCInitialSweep(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", CleanupInterval: time.Hour}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader(data))
+	fc.Write(ctx, "key2", sampleReader(data))
+	fc.touch("key1", time.Now().Add(-time.Minute))
+	fc.UpdateLimits(int64(len(data)), 0)
+
+	fc.RunGC()
+	defer fc.StopGC()
+	for i := 0; i < 100 && fc.Has("key1"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fc.Has("key1") || !fc.Has("key2") {
+		t.Fatal("over-limit cache must be trimmed right after RunGC")
+	}
+}
+
+func TestOpError(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	_, err := fc.Read(ctx, "missing")
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatal("read must fail with an OpError", err)
+	}
+	if opErr.Op != "read" || opErr.Key != "missing" {
+		t.Fatal("unexpected op error", opErr)
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("op error must match its cause", err)
+	}
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	err = fc.Write(ctx, "key", sampleReader("ABC"))
+	if !errors.As(err, &opErr) || opErr.Op != "write" || !errors.Is(err, ErrKeyExists) {
+		t.Fatal("write must fail with an OpError matching ErrKeyExists", err)
+	}
+	if err := fc.Delete(ctx, "missing"); !errors.As(err, &opErr) || opErr.Op != "delete" {
+		t.Fatal("delete must fail with an OpError", err)
+	}
+}
+
+func TestZeroByteEntry(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "empty", sampleReader("")); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("empty") {
+		t.Fatal("empty entry must be present")
+	}
+	if info, err := fc.Stat(ctx, "empty"); err != nil || info.Size != 0 {
+		t.Fatal("empty entry must have size 0", info, err)
+	}
+	r, err := fc.Read(ctx, "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || len(data) != 0 {
+		t.Fatal("empty entry must read empty", data, err)
+	}
+
+	if _, err := fc.Read(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("missing entry must be distinct from an empty one", err)
+	}
+}
+
+func TestGCWriteThreshold(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	runs := make(chan GCResult, 10)
+	fc := MustNew(Config{
+		TempDir:          "tmp",
+		CleanupInterval:  time.Hour,
+		GCWriteThreshold: int64(len(data)) * 2,
+		OnGCComplete:     func(result GCResult, totalSize int64, entryCount int) { runs <- result },
+	}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.RunGC()
+	defer fc.StopGC()
+	<-runs
+
+	fc.Write(ctx, "key1", sampleReader(data))
+	select {
+	case <-runs:
+		t.Fatal("GC must not run below the threshold")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.Namespace("ns").Write(ctx, "key2", sampleReader(data))
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("GC must run once the threshold is crossed")
+	}
+}
+
+func TestRunGCSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	runs := make(chan time.Time, 100)
+	fc := MustNew(Config{
+		TempDir:         "tmp",
+		CleanupInterval: 50 * time.Millisecond,
+		OnGCComplete:    func(result GCResult, totalSize int64, entryCount int) { runs <- time.Now() },
+	}, nil)
+	defer fc.Destroy(ctx)
+
+	start := time.Now()
+	fc.RunGC()
+	time.Sleep(275 * time.Millisecond)
+	fc.StopGC()
+
+	if n := len(runs); n < 5 || n > 7 {
+		t.Fatal("GC must run right away and once per interval", n)
+	}
+	if first := <-runs; first.Sub(start) > 25*time.Millisecond {
+		t.Fatal("first GC run must not wait for the interval", first.Sub(start))
+	}
+}
+
+func TestGCDelay(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", GCJitter: time.Second}, nil)
+	defer fc.Destroy(ctx)
+
+	rng := rand.New(rand.NewSource(1))
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if d := fc.gcDelay(now.Add(time.Minute), now, rng); d < time.Minute || d > time.Minute+time.Second {
+			t.Fatal("jitter must delay runs by up to GCJitter", d)
+		}
+	}
+	if d := fc.gcDelay(now.Add(-time.Minute), now, rng); d > time.Second {
+		t.Fatal("an overdue run must not wait for the missed interval", d)
+	}
+	if _, err := New(Config{TempDir: "tmp", GCJitter: -time.Second}, nil); err == nil {
+		t.Fatal("a negative GC jitter must be rejected")
+	}
+}
+
+// orderedLockFactory records the global lock taken while a key lock is
+// held, the reverse of the order of the GC.
+type orderedLockFactory struct {
+	*LockFactory
+	global   string
+	reversed bool
+}
+
+func (fac *orderedLockFactory) Lock(ctx context.Context, key string) (ILock, error) {
+	if key == fac.global {
+		fac.mutex.Lock()
+		for held := range fac.locks {
+			if held != fac.global {
+				fac.reversed = true
+			}
+		}
+		fac.mutex.Unlock()
+	}
+	return fac.LockFactory.Lock(ctx, key)
+}
+
+func TestEvictBeforeWriteLockOrder(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	lockFactory := &orderedLockFactory{
+		LockFactory: &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}},
+		global:      defaultLockKey,
+	}
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)), EvictBeforeWrite: true}, lockFactory)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader(data))
+	if err := fc.Write(ctx, "key2", sampleReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key1") || !fc.Has("key2") {
+		t.Fatal("least recently used entry must be evicted before the write")
+	}
+	if lockFactory.reversed {
+		t.Fatal("global lock must not be taken holding a key lock")
+	}
+	if lockFactory.Has(ctx, fc.keylock("key2")) {
+		t.Fatal("key lock must be released after the write")
+	}
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	config := fc.EffectiveConfig()
+	if !filepath.IsAbs(config.BaseDir) || filepath.Base(config.BaseDir) != defaultBaseDir {
+		t.Fatal("base dir must be resolved", config.BaseDir)
+	}
+	if !filepath.IsAbs(config.TempDir) {
+		t.Fatal("temp dir must be resolved", config.TempDir)
+	}
+	if config.MaxSize != defaultMaxSize || config.MaxTTL != defaultMaxTTL || config.CleanupInterval != defaultCleanupInterval {
+		t.Fatal("default limits must be applied", config)
+	}
+	if config.LogLevel != defaultLogLevel || config.LockNamespace != defaultLockKey {
+		t.Fatal("defaults must be applied", config)
+	}
+
+	fc.UpdateLimits(1024, time.Minute)
+	if config := fc.EffectiveConfig(); config.MaxSize != 1024 || config.MaxTTL != time.Minute {
+		t.Fatal("updated limits must be reported", config)
+	}
+}
+
+func TestMaxServeAge(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, MaxServeAge: time.Minute}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal("fresh entry must be served", err)
+	}
+	r.Close()
+
+	// reads refresh the mod time, the age is counted from the write
+	fc.updateSidecar(ctx, "key", func(sc *sidecar) { sc.WrittenAt = time.Now().Add(-2 * time.Minute).UnixNano() })
+	if _, err := fc.Read(ctx, "key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("entry past MaxServeAge must not be served", err)
+	}
+	if fc.Has("key") {
+		t.Fatal("entry past MaxServeAge must be deleted")
+	}
+}
+
+func TestEnsureDirRace(t *testing.T) {
+	defer func(f func(string, os.FileMode) error) { mkdirAll = f }(mkdirAll)
+	mkdirAll = func(dir string, perm os.FileMode) error {
+		// another process created the directory first
+		os.MkdirAll(dir, perm)
+		return &os.PathError{Op: "mkdir", Path: dir, Err: errors.New("spurious failure")}
+	}
+
+	dir, err := ensureDir("filecache_race")
+	if err != nil {
+		t.Fatal("existing directory must be accepted", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0666)
+	if _, err := ensureDir(file); err == nil {
+		t.Fatal("a file must not be accepted as a directory")
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := fc.WriteAt(ctx, "key1", sampleReader("ABC"), modTime); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := fc.Stat(ctx, "key1"); !info.ModTime.Equal(modTime) {
+		t.Fatal("entry must carry the given mod time", info.ModTime)
+	}
+
+	before := time.Now().Add(-time.Second)
+	if err := fc.WriteAt(ctx, "key2", sampleReader("ABC"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := fc.Stat(ctx, "key2"); info.ModTime.Before(before) {
+		t.Fatal("zero mod time must fall back to now", info.ModTime)
+	}
+	if oldest, _, _ := fc.Oldest(ctx); oldest != "key1" {
+		t.Fatal("entry written in the past must be the oldest", oldest)
+	}
+}
+
+func TestKeyIsDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := os.Mkdir(filepath.Join(fc.BaseDir, "dir"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("dir") {
+		t.Fatal("directory must not be an entry")
+	}
+	if _, err := fc.Stat(ctx, "dir"); !errors.Is(err, ErrKeyIsDirectory) {
+		t.Fatal("stat must tell a directory from a missing key", err)
+	}
+	if _, err := fc.Read(ctx, "dir"); !errors.Is(err, ErrKeyIsDirectory) {
+		t.Fatal("read must tell a directory from a missing key", err)
+	}
+	if err := fc.Write(ctx, "dir", sampleReader("ABC")); !errors.Is(err, ErrKeyIsDirectory) {
+		t.Fatal("write must fail with ErrKeyIsDirectory", err)
+	}
+	if _, err := fc.Stat(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("missing key must not be found", err)
+	}
+}
+
+func TestDisableTouch(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", DisableTouch: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	fc.touch("key", old)
+
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if info, _ := fc.Stat(ctx, "key"); !info.ModTime.Equal(old) {
+		t.Fatal("read must not touch the entry", info.ModTime)
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	ctx := context.Background()
+
+	for _, disableTouch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("DisableTouch=%v", disableTouch), func(b *testing.B) {
+			fc := MustNew(Config{TempDir: "tmp", DisableTouch: disableTouch, Silent: true}, nil)
+			defer fc.Destroy(ctx)
+			fc.Write(ctx, "key", strings.NewReader(strings.Repeat("a", 4096)))
+
+			for i := 0; i < b.N; i++ {
+				r, err := fc.Read(ctx, "key")
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, r)
+				r.Close()
+			}
+		})
+	}
+}
+
+func TestWriteWithTTL(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.WriteWithTTL(ctx, "short", sampleReader("ABC"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.WriteWithTTL(ctx, "long", sampleReader("ABC"), 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	fc.Write(ctx, "default", sampleReader("ABC"))
+	// past MaxTTL, but within the TTL of "long"
+	for _, key := range []string{"long", "default"} {
+		fc.touch(key, time.Now().Add(-90*time.Minute))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TTLEvicted != 2 || fc.Has("short") || fc.Has("default") || !fc.Has("long") {
+		t.Fatal("TTL cleaner must honor the TTL of each entry", result)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{TempDir: "tmp", MaxSize: -1},
+		{TempDir: "tmp", MaxTTL: -time.Second},
+		{TempDir: "tmp", CleanupInterval: -time.Second},
+		{TempDir: "tmp", MinEntrySize: 10, MaxEntrySize: 5},
+	} {
+		if _, err := New(config, nil); err == nil {
+			t.Fatal("invalid config must be rejected", config)
+		}
+	}
+
+	file := filepath.Join(os.TempDir(), "filecache_not_a_dir")
+	os.WriteFile(file, nil, 0666)
+	defer os.Remove(file)
+	if _, err := New(Config{BaseDir: file, TempDir: "tmp"}, nil); err == nil {
+		t.Fatal("base dir which can not be created must be rejected")
+	}
+}
@@ -0,0 +1,41 @@
+package filecache
+
+import (
+	"sync"
+	"time"
+)
+
+// GCReport describes a GC run.
+type GCReport struct {
+	GCResult
+	// Scanned is the number of entries examined, namespaces included.
+	Scanned int
+	Started time.Time
+	// Duration is the time the run took, waiting for the lock included.
+	Duration time.Duration
+	// Err is the error which ended the run early, if any.
+	Err error
+}
+
+// gcReports keeps the report of the last GC run of a root cache.
+type gcReports struct {
+	mutex sync.Mutex
+	last  GCReport
+}
+
+// LastGCReport returns the report of the last GC run of the cache and its
+// namespaces, a zero report if none ran yet.
+func (f *FileCache) LastGCReport() GCReport {
+	f.root.gcReports.mutex.Lock()
+	defer f.root.gcReports.mutex.Unlock()
+	return f.root.gcReports.last
+}
+
+// recordGC keeps report as the last one and publishes it as an EventGC.
+func (f *FileCache) recordGC(report GCReport) {
+	f.root.gcReports.mutex.Lock()
+	f.root.gcReports.last = report
+	f.root.gcReports.mutex.Unlock()
+	f.root.activity.gcDone(report.Started.Add(report.Duration))
+	f.emit(Event{Type: EventGC, GC: report})
+}
@@ -0,0 +1,63 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLastGCReport(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 4, MaxTTL: time.Hour}, nil)
+	defer fc.Destroy(ctx)
+
+	if report := fc.LastGCReport(); !report.Started.IsZero() {
+		t.Fatal("no report must be recorded before a run", report)
+	}
+	for _, key := range []string{"expired", "old", "new"} {
+		fc.Write(ctx, key, sampleReader("ABC"))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(fc.absFilePath("expired"), old, old)
+	old = time.Now().Add(-time.Minute)
+	os.Chtimes(fc.absFilePath("old"), old, old)
+
+	start := time.Now()
+	fc.cleanCachedFiles(ctx)
+	report := fc.LastGCReport()
+	if report.Scanned != 3 || report.TTLEvicted != 1 || report.LRUEvicted != 1 || report.BytesFreed != 6 {
+		t.Fatal("report must describe the run", report)
+	}
+	if report.Started.Before(start) || report.Duration <= 0 || report.Err != nil {
+		t.Fatal("report must time the run", report)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	fc.cleanCachedFiles(cctx)
+	if report := fc.LastGCReport(); !errors.Is(report.Err, context.Canceled) {
+		t.Fatal("report must record the error of the run", report.Err)
+	}
+}
+
+func TestCleanNow(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 3}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader("ABC"))
+	fc.Namespace("ns").Write(ctx, "key2", sampleReader("ABC"))
+	fc.Namespace("ns").Write(ctx, "key3", sampleReader("ABC"))
+
+	report, err := fc.CleanNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 3 || report.LRUEvicted != 1 || fc.LastGCReport() != report {
+		t.Fatal("CleanNow must sweep the cache and its namespaces", report)
+	}
+}
@@ -0,0 +1,101 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// FillFunc writes the content of a missing entry to w. It must not write
+// to the cache, such writes deadlock with a pending Flush.
+type FillFunc func(w io.Writer) error
+
+// flight is a fill in progress, done is closed once it is over.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// flights tracks the fills in progress by key lock, so concurrent callers
+// of GetOrWrite wait for a single fill.
+type flights struct {
+	mutex sync.Mutex
+	calls map[string]*flight
+}
+
+// do runs fn unless a call of key is in progress, and returns the error of
+// the call either way. Waiters give up when ctx is done, the call goes on.
+func (g *flights) do(ctx context.Context, key string, fn func() error) error {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flight{}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &flight{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(call.done)
+	}()
+	call.err = fn()
+	return call.err
+}
+
+// GetOrWrite returns the entry of key, filling it with fill first if it is
+// missing. Concurrent calls for the same key, in this process, run a single
+// fill and all read its result; they all get its error if it fails. An
+// error of fill aborts the write and is returned as is.
+func (f *FileCache) GetOrWrite(ctx context.Context, key string, fill FillFunc) (io.ReadCloser, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, opError("read", key, err)
+	}
+	f.frequency.add(key)
+	r, err := f.read(ctx, key, !f.DisableTouch)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return r, opError("read", key, err)
+	}
+	err = f.root.flights.do(ctx, f.keylock(key), func() error {
+		return f.fill(ctx, key, WriteOptions{}, fill)
+	})
+	if err != nil {
+		return nil, opError("write", key, err)
+	}
+	r, err = f.read(ctx, key, !f.DisableTouch)
+	return r, opError("read", key, err)
+}
+
+// fill writes the entry of key with fill, unless it was written since it
+// was found missing and opts do not overwrite it.
+func (f *FileCache) fill(ctx context.Context, key string, opts WriteOptions, fill FillFunc) error {
+	w, err := f.create(ctx, key, opts)
+	if errors.Is(err, ErrKeyExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fill(w); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil && !errors.Is(err, ErrKeyExists) {
+		return err
+	}
+	if f.Fallback != nil {
+		go f.writeFallback(key)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrWrite(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	var fills int32
+	fill := func(w io.Writer) error {
+		atomic.AddInt32(&fills, 1)
+		time.Sleep(50 * time.Millisecond)
+		_, err := io.WriteString(w, "bytesample")
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := fc.GetOrWrite(ctx, "key", fill)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer r.Close()
+			if data, _ := io.ReadAll(r); string(data) != "bytesample" {
+				errs <- errors.New("unexpected content " + string(data))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if fills != 1 {
+		t.Fatal("fill must run once for concurrent callers", fills)
+	}
+
+	r, err := fc.GetOrWrite(ctx, "key", fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if fills != 1 {
+		t.Fatal("fill must not run for a cached key", fills)
+	}
+
+	errFailed := errors.New("failed")
+	_, err = fc.GetOrWrite(ctx, "failed", func(w io.Writer) error { return errFailed })
+	if !errors.Is(err, errFailed) || fc.Has("failed") {
+		t.Fatal("error of fill must be returned and nothing written", err)
+	}
+}
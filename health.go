@@ -0,0 +1,35 @@
+package filecache
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// HealthCheck reports whether the cache directories are accessible and
+// writable. It creates and removes a tiny temp file in TempDir but never
+// touches the cached entries.
+func (f *FileCache) HealthCheck(ctx context.Context) error {
+	for _, dir := range []string{f.BaseDir, f.TempDir} {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("unhealthy cache: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("unhealthy cache: %s is not a directory", dir)
+		}
+	}
+
+	tmp, err := os.CreateTemp(f.TempDir, tempFilePrefix+"health-")
+	if err != nil {
+		return fmt.Errorf("unhealthy cache: temp dir is not writable: %w", err)
+	}
+	tmp.Close()
+	if err := os.Remove(tmp.Name()); err != nil {
+		return fmt.Errorf("unhealthy cache: %w", err)
+	}
+	return nil
+}
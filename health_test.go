@@ -0,0 +1,23 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if err := fc.HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	os.RemoveAll(fc.BaseDir)
+	if err := fc.HealthCheck(ctx); err == nil {
+		t.Fatal("missing base dir must be unhealthy")
+	}
+}
@@ -0,0 +1,73 @@
+package filecache
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	histogramAges  = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+	histogramSizes = []int64{4 * 1024, 1024 * 1024, 100 * 1024 * 1024}
+)
+
+// AgeBucket counts the entries whose age is below Max, and above the Max of
+// the previous bucket. The last bucket has no upper bound and a zero Max.
+type AgeBucket struct {
+	Max   time.Duration
+	Count int
+	Bytes int64
+}
+
+// SizeBucket counts the entries whose size is below Max, and above the Max
+// of the previous bucket. The last bucket has no upper bound and a zero Max.
+type SizeBucket struct {
+	Max   int64
+	Count int
+	Bytes int64
+}
+
+// Histogram is the distribution of the entries of a cache by age, measured
+// from their modification time, and by size.
+type Histogram struct {
+	Age  []AgeBucket
+	Size []SizeBucket
+}
+
+// Histogram returns the distribution of the entries by age and size, it
+// reads the cache directory once.
+func (f *FileCache) Histogram(ctx context.Context) (Histogram, error) {
+	files, err := f.files(ctx)
+	if err != nil {
+		return Histogram{}, err
+	}
+
+	h := Histogram{
+		Age:  make([]AgeBucket, len(histogramAges)+1),
+		Size: make([]SizeBucket, len(histogramSizes)+1),
+	}
+	for i, max := range histogramAges {
+		h.Age[i].Max = max
+	}
+	for i, max := range histogramSizes {
+		h.Size[i].Max = max
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		age := now.Sub(file.ModTime())
+		i := 0
+		for i < len(histogramAges) && age >= histogramAges[i] {
+			i++
+		}
+		h.Age[i].Count++
+		h.Age[i].Bytes += file.Size()
+
+		j := 0
+		for j < len(histogramSizes) && file.Size() >= histogramSizes[j] {
+			j++
+		}
+		h.Size[j].Count++
+		h.Size[j].Bytes += file.Size()
+	}
+	return h, nil
+}
@@ -0,0 +1,32 @@
+package filecache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	fc.Write(ctx, "new", sampleReader("ABC"))
+	fc.Write(ctx, "hour", sampleReader("ABC"))
+	fc.touch("hour", time.Now().Add(-2*time.Hour))
+	fc.Write(ctx, "big", sampleReader(strings.Repeat("A", 8*1024)))
+	fc.touch("big", time.Now().Add(-48*time.Hour))
+
+	h, err := fc.Histogram(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Age[0].Count != 1 || h.Age[2].Count != 1 || h.Age[3].Count != 1 || h.Age[3].Bytes != 8*1024 {
+		t.Fatal("age buckets not match", h.Age)
+	}
+	if h.Size[0].Count != 2 || h.Size[0].Bytes != 6 || h.Size[1].Count != 1 {
+		t.Fatal("size buckets not match", h.Size)
+	}
+}
@@ -0,0 +1,79 @@
+package filecache
+
+import (
+	"io"
+	"io/fs"
+)
+
+// Reason tells why a hook is called.
+type Reason string
+
+const (
+	// ReasonDelete is an entry removed by Delete.
+	ReasonDelete Reason = "delete"
+	// ReasonTTL is an entry removed once it outlived its TTL, by the GC or
+	// by a read.
+	ReasonTTL Reason = "ttl"
+	// ReasonLRU is an entry evicted to fit the cache within its limits,
+	// whatever the eviction policy.
+	ReasonLRU Reason = "lru"
+
+	// ReasonNew and ReasonOverwrite are writes of a new key and of an
+	// existing one.
+	ReasonNew       Reason = "new"
+	ReasonOverwrite Reason = "overwrite"
+
+	// ReasonCache, ReasonFallback and ReasonLoader are reads served from
+	// the cache, the fallback cache and the Loader.
+	ReasonCache    Reason = "cache"
+	ReasonFallback Reason = "fallback"
+	ReasonLoader   Reason = "loader"
+
+	// ReasonNotFound is a key missing from the cache, ReasonNegative one
+	// known to be missing, see Config.NegativeTTL.
+	ReasonNotFound Reason = "not_found"
+	ReasonNegative Reason = "negative"
+)
+
+// HookFunc is called with the key and the size of an entry, zero when it is
+// missing.
+type HookFunc func(key string, size int64, reason Reason)
+
+// Hooks are called synchronously as entries come and go, a panic in a hook
+// is recovered and logged. Unlike Config.OnWrite they can not fail the
+// operation.
+type Hooks struct {
+	// OnEvict is called when an entry is removed, but not by Flush and
+	// Empty which remove every entry at once.
+	OnEvict HookFunc
+	// OnWrite is called when an entry is committed.
+	OnWrite HookFunc
+	// OnHit is called when a read serves an entry.
+	OnHit HookFunc
+	// OnMiss is called when a read does not find a key in the cache, before
+	// it is read from the fallback cache or the Loader.
+	OnMiss HookFunc
+}
+
+// callHook calls hook, if set, recovering from a panic in it.
+func (f *FileCache) callHook(name string, hook HookFunc, key string, size int64, reason Reason) {
+	if hook == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			f.Logger.WithField("key", key).Errorf("Recovered from panic in %s: %v", name, r)
+		}
+	}()
+	hook(key, size, reason)
+}
+
+// readerSize returns the size of the entry served by r, zero if unknown.
+func readerSize(r io.Reader) int64 {
+	if s, ok := r.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := s.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return 0
+}
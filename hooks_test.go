@@ -0,0 +1,68 @@
+package filecache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	var calls []string
+	record := func(name string) HookFunc {
+		return func(key string, size int64, reason Reason) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			calls = append(calls, fmt.Sprintf("%s %s %d %s", name, key, size, reason))
+		}
+	}
+	hooks := Hooks{OnEvict: record("evict"), OnWrite: record("write"), OnHit: record("hit"), OnMiss: record("miss")}
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 5, Hooks: hooks}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader("ABC"))
+	fc.Set(ctx, "key1", sampleReader("ABCD"))
+	r, err := fc.Read(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+	fc.Write(ctx, "key2", sampleReader("EF"))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(fc.absFilePath("key1"), old, old)
+	if _, err := fc.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fc.Delete(ctx, "key2")
+
+	expected := []string{
+		"write key1 3 new",
+		"write key1 4 overwrite",
+		"hit key1 4 cache",
+		"miss missing 0 not_found",
+		"write key2 2 new",
+		"evict key1 4 lru",
+		"evict key2 2 delete",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatal("hooks must be called as entries come and go", calls)
+	}
+}
+
+func TestHookPanic(t *testing.T) {
+	ctx := context.Background()
+
+	onWrite := func(key string, size int64, reason Reason) { panic("hook") }
+	fc := MustNew(Config{TempDir: "tmp", Hooks: Hooks{OnWrite: onWrite}}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil || !fc.Has("key") {
+		t.Fatal("a panic in a hook must not fail the write", err)
+	}
+}
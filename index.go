@@ -0,0 +1,140 @@
+package filecache
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// index keeps the metadata of the entries of a cache in memory, see
+// Config.InMemoryIndex. Entries are indexed by file name. The methods of a
+// nil index do nothing, the cache then works from the filesystem.
+type index struct {
+	mutex   sync.RWMutex
+	entries map[string]indexEntry
+}
+
+// indexEntry is the metadata of an indexed entry, it implements
+// fs.FileInfo so the index can stand in for a directory listing.
+type indexEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	// expiresAt, pinned and hits mirror the sidecar of the entry.
+	expiresAt int64
+	pinned    bool
+	hits      int64
+}
+
+func (e indexEntry) sidecar() sidecar {
+	return sidecar{ExpiresAt: e.expiresAt, Pinned: e.pinned, Hits: e.hits}
+}
+
+func (e indexEntry) Name() string       { return e.name }
+func (e indexEntry) Size() int64        { return e.size }
+func (e indexEntry) Mode() fs.FileMode  { return 0 }
+func (e indexEntry) ModTime() time.Time { return e.modTime }
+func (e indexEntry) IsDir() bool        { return false }
+func (e indexEntry) Sys() interface{}   { return nil }
+
+func (x *index) get(name string) (indexEntry, bool) {
+	if x == nil {
+		return indexEntry{}, false
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	e, ok := x.entries[name]
+	return e, ok
+}
+
+func (x *index) put(e indexEntry) {
+	if x == nil {
+		return
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.entries[e.name] = e
+}
+
+func (x *index) remove(name string) {
+	if x == nil {
+		return
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	delete(x.entries, name)
+}
+
+// touch updates the modification time of an indexed entry.
+func (x *index) touch(name string, modTime time.Time) {
+	x.update(name, func(e *indexEntry) { e.modTime = modTime })
+}
+
+// setSidecar updates an indexed entry from its new sidecar.
+func (x *index) setSidecar(name string, sc sidecar) {
+	x.update(name, func(e *indexEntry) { e.expiresAt, e.pinned, e.hits = sc.ExpiresAt, sc.Pinned, sc.Hits })
+}
+
+func (x *index) update(name string, fn func(e *indexEntry)) {
+	if x == nil {
+		return
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if e, ok := x.entries[name]; ok {
+		fn(&e)
+		x.entries[name] = e
+	}
+}
+
+// files returns the indexed entries, sorted like a listing of the cache.
+func (x *index) files() []fs.FileInfo {
+	x.mutex.RLock()
+	list := make([]fs.FileInfo, 0, len(x.entries))
+	for _, e := range x.entries {
+		list = append(list, e)
+	}
+	x.mutex.RUnlock()
+	sortFiles(list)
+	return list
+}
+
+func (x *index) reset(entries map[string]indexEntry) {
+	if x == nil {
+		return
+	}
+	if entries == nil {
+		entries = map[string]indexEntry{}
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.entries = entries
+}
+
+// loadIndex fills the index from the entries on disk and their sidecars.
+func (f *FileCache) loadIndex(ctx context.Context) error {
+	if f.index == nil {
+		return nil
+	}
+	files, err := f.scanFiles(ctx)
+	if err != nil {
+		return err
+	}
+	sidecars, err := f.sidecarNames(ctx)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]indexEntry, len(files))
+	for _, file := range files {
+		e := indexEntry{name: file.Name(), size: file.Size(), modTime: file.ModTime()}
+		if sidecars[file.Name()] {
+			if sc, err := f.readSidecar(f.nameKey(file.Name())); err == nil {
+				e.expiresAt, e.pinned, e.hits = sc.ExpiresAt, sc.Pinned, sc.Hits
+			}
+		}
+		entries[e.name] = e
+	}
+	f.index.reset(entries)
+	return nil
+}
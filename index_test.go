@@ -0,0 +1,58 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestInMemoryIndex(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, InMemoryIndex: true}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "key1", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.WriteWithTTL(ctx, "key2", sampleReader("DEFG"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("key1") || !fc.Has("key2") {
+		t.Fatal("written keys must be indexed")
+	}
+	if size, _ := fc.Size(); size != 7 {
+		t.Fatal("size must be served from the index", size)
+	}
+
+	loaded := MustNew(Config{BaseDir: fc.BaseDir, TempDir: "tmp", InMemoryIndex: true}, nil)
+	if keys, _ := loaded.Keys(); len(keys) != 2 {
+		t.Fatal("the index must be loaded from disk", keys)
+	}
+
+	time.Sleep(time.Millisecond)
+	if evicted, _, err := fc.cleanCachedFileByTTL(ctx); err != nil || evicted != 1 {
+		t.Fatal("entries must expire by their indexed TTL", evicted, err)
+	}
+	if fc.Has("key2") {
+		t.Fatal("evicted keys must be removed from the index")
+	}
+
+	if err := os.Remove(fc.absFilePath("key1")); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("key1") {
+		t.Fatal("changes out of band must not be seen before a resync")
+	}
+	if err := fc.Resync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key1") {
+		t.Fatal("resync must reload the index")
+	}
+	if _, err := fc.Read(ctx, "key1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("reads of unindexed keys must miss", err)
+	}
+}
@@ -0,0 +1,70 @@
+package filecache
+
+import (
+	"context"
+	"sync"
+)
+
+// Op is an operation of a cache reported to an Instrument.
+type Op struct {
+	// Name is "read", "write", "delete" or "gc".
+	Name string
+	// Namespace is the namespace of the cache, empty for the root cache.
+	Namespace string
+	// Key is the key of the operation, empty for "gc".
+	Key string
+}
+
+// OpResult is the outcome of an Op.
+type OpResult struct {
+	// Bytes are the bytes read or written, deleted or freed by the GC.
+	Bytes int64
+	// Hit reports whether a read was served from the cache itself, rather
+	// than from the fallback cache or the Loader, or not at all.
+	Hit bool
+	Err error
+}
+
+// Instrument observes the operations of a cache, e.g. to record metrics or
+// traces. StartOp is called as op starts and returns the context the op
+// runs with, and a function called with its result once it is over. Both
+// are called synchronously so they must be fast.
+type Instrument interface {
+	StartOp(ctx context.Context, op Op) (context.Context, func(OpResult))
+}
+
+// instruments are the instruments of a root cache and its namespaces.
+type instruments struct {
+	mutex sync.RWMutex
+	list  []Instrument
+}
+
+// Instrument adds inst to the instruments of the cache. They are shared by
+// the root cache and its namespaces, so it observes all of them.
+func (f *FileCache) Instrument(inst Instrument) {
+	f.root.instruments.mutex.Lock()
+	defer f.root.instruments.mutex.Unlock()
+	f.root.instruments.list = append(f.root.instruments.list, inst)
+}
+
+// startOp reports the start of the op name on key to the instruments. The
+// returned function reports its result.
+func (f *FileCache) startOp(ctx context.Context, name, key string) (context.Context, func(OpResult)) {
+	f.root.instruments.mutex.RLock()
+	list := f.root.instruments.list
+	f.root.instruments.mutex.RUnlock()
+	if len(list) == 0 {
+		return ctx, func(OpResult) {}
+	}
+
+	op := Op{Name: name, Namespace: f.namespace, Key: key}
+	ends := make([]func(OpResult), len(list))
+	for i, inst := range list {
+		ctx, ends[i] = inst.StartOp(ctx, op)
+	}
+	return ctx, func(result OpResult) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](result)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package filecache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type recordingInstrument struct {
+	ops []string
+}
+
+func (i *recordingInstrument) StartOp(ctx context.Context, op Op) (context.Context, func(OpResult)) {
+	return ctx, func(result OpResult) {
+		i.ops = append(i.ops, fmt.Sprintf("%s %s/%s %d %t %v", op.Name, op.Namespace, op.Key, result.Bytes, result.Hit, result.Err != nil))
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 3}, nil)
+	defer fc.Destroy(ctx)
+	inst := &recordingInstrument{}
+	fc.Instrument(inst)
+
+	ns := fc.Namespace("ns")
+	ns.Write(ctx, "key", sampleReader("ABC"))
+	r, err := ns.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+	ns.Delete(ctx, "key")
+	fc.cleanCachedFiles(ctx)
+
+	expected := []string{
+		"write ns/key 3 false false",
+		"read ns/key 3 true false",
+		"read /missing 0 false true",
+		"delete ns/key 3 false false",
+		"gc / 0 false false",
+	}
+	if fmt.Sprint(inst.ops) != fmt.Sprint(expected) {
+		t.Fatal("operations must be reported to instruments", inst.ops)
+	}
+}
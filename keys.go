@@ -0,0 +1,100 @@
+package filecache
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// KeyEncoder maps keys to the names of their files. Decode reverses Encode,
+// reporting false for encodings which can't be reversed; the keys of such
+// entries are then read from their sidecar.
+type KeyEncoder interface {
+	Encode(key string) string
+	Decode(name string) (string, bool)
+}
+
+var (
+	// EscapedKeys escapes path separators and other special characters of
+	// keys, so every key is stored as a single file of BaseDir. It is the
+	// default encoder.
+	EscapedKeys KeyEncoder = escapedKeys{}
+
+	// RawKeys uses keys as file names, for trusted callers wanting
+	// human-readable names. Keys containing path separators are rejected.
+	RawKeys KeyEncoder = rawKeys{}
+
+	// HashedKeys stores every key under its SHA-256 hash, hiding keys from
+	// the file names.
+	HashedKeys KeyEncoder = hashedKeys{}
+)
+
+type escapedKeys struct{}
+
+func (escapedKeys) Encode(key string) string {
+	switch key {
+	case ".", "..":
+		// dot names refer to directories whatever their escaping
+		return strings.Repeat("%2E", len(key))
+	}
+	return url.PathEscape(key)
+}
+
+func (escapedKeys) Decode(name string) (string, bool) {
+	key, err := url.PathUnescape(name)
+	return key, err == nil
+}
+
+type rawKeys struct{}
+
+func (rawKeys) Encode(key string) string {
+	return key
+}
+
+func (rawKeys) Decode(name string) (string, bool) {
+	return name, true
+}
+
+type hashedKeys struct{}
+
+func (hashedKeys) Encode(key string) string {
+	return hashName(key)
+}
+
+func (hashedKeys) Decode(name string) (string, bool) {
+	return "", false
+}
+
+func (f *FileCache) keyEncoder() KeyEncoder {
+	if f.KeyEncoder == nil {
+		return EscapedKeys
+	}
+	return f.KeyEncoder
+}
+
+// nameKey returns a key addressing the file of name, without reading its
+// sidecar: the decoded key, or the name itself for hashed names.
+func (f *FileCache) nameKey(name string) string {
+	if isHashedName(name) {
+		return name
+	}
+	if key, ok := f.keyEncoder().Decode(name); ok {
+		return key
+	}
+	return name
+}
+
+// isLocalName reports whether the file name of a key stays below BaseDir.
+func isLocalName(name string) bool {
+	if len(name) == 0 || filepath.IsAbs(name) || len(filepath.VolumeName(name)) > 0 {
+		return false
+	}
+	name = filepath.Clean(name)
+	return name != "." && name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
+
+// isNestedName reports whether the file name of a key would be stored in a
+// sub-directory, where entries are neither listed nor evicted.
+func isNestedName(name string) bool {
+	return strings.ContainsAny(name, "/"+string(filepath.Separator))
+}
@@ -0,0 +1,101 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestKeyEncoder(t *testing.T) {
+	ctx := context.Background()
+
+	for _, encoder := range []KeyEncoder{EscapedKeys, HashedKeys} {
+		fc := MustNew(Config{TempDir: "tmp", KeyEncoder: encoder}, nil)
+
+		keys := []string{"../../etc/passwd", "..", "a/b", "plain"}
+		for _, key := range keys {
+			if err := fc.Write(ctx, key, sampleReader(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(fc.BaseDir), "etc")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatal("keys must not escape the base dir", err)
+		}
+		entries, _ := os.ReadDir(fc.BaseDir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				t.Fatal("keys must be stored as files of the base dir", entry.Name())
+			}
+		}
+
+		got, _ := fc.Keys()
+		sort.Strings(got)
+		sort.Strings(keys)
+		if len(got) != len(keys) {
+			t.Fatal("keys must be reported decoded", got)
+		}
+		for i := range keys {
+			if got[i] != keys[i] {
+				t.Fatal("keys must be reported decoded", got)
+			}
+		}
+
+		for _, key := range keys {
+			if err := fc.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fc.Destroy(ctx)
+	}
+}
+
+func TestRawKeys(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", KeyEncoder: RawKeys}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "readable", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(fc.BaseDir, "readable")); err != nil {
+		t.Fatal("raw keys must be used as file names", err)
+	}
+	for _, key := range []string{"../escape", "..", "/abs"} {
+		if err := fc.Write(ctx, key, sampleReader("ABC")); !errors.Is(err, ErrInvalidKey) {
+			t.Fatal("keys escaping the base dir must be rejected", key, err)
+		}
+	}
+}
+
+func TestRawKeysWithSlash(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", KeyEncoder: RawKeys, MaxSize: 1}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "a/b", sampleReader("ABC")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal("raw keys with a slash must be rejected", err)
+	}
+	if _, err := os.Stat(filepath.Join(fc.BaseDir, "a")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("rejected keys must not create directories", err)
+	}
+	if err := fc.Write(ctx, "a", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := fc.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Fatal("every entry must be listed", keys)
+	}
+	if size, _ := fc.Size(); size != 3 {
+		t.Fatal("every entry must be counted", size)
+	}
+	if _, err := fc.CleanNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := fc.Keys(); len(keys) != 0 {
+		t.Fatal("entries over MaxSize must be evicted", keys)
+	}
+}
@@ -0,0 +1,41 @@
+package filecache
+
+import (
+	"context"
+	"sort"
+)
+
+// LFU is an eviction policy for caches with a hot set: it evicts the
+// expired entries, then the least frequently accessed ones until the cache
+// fits within its limits, so a scan reading every entry once does not push the
+// hot entries out. Entries accessed as often are evicted least recently
+// used first. Accesses are counted with Config.PersistAccessCount, without
+// it LFU behaves like TTLLRU.
+var LFU EvictionPolicy = lfu{}
+
+type lfu struct{}
+
+func (lfu) Candidates(ctx context.Context, state EvictionState) []string {
+	var keys []string
+	var live []EntryInfo
+	size, count := state.Size, state.Count
+	for _, entry := range state.Entries {
+		if state.Expired(entry) {
+			keys = append(keys, entry.Key)
+			size, count = size-entry.Size, count-1
+		} else {
+			live = append(live, entry)
+		}
+	}
+	sort.SliceStable(live, func(i, j int) bool {
+		return state.Hits(live[i]) < state.Hits(live[j])
+	})
+	for _, entry := range live {
+		if state.fits(size, count) {
+			break
+		}
+		keys = append(keys, entry.Key)
+		size, count = size-entry.Size, count-1
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+package filecache
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestLFU(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)) * 2, PersistAccessCount: true, EvictionPolicy: LFU}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "hot", sampleReader(data))
+	for i := 0; i < 3; i++ {
+		r, err := fc.Read(ctx, "hot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, r)
+		r.Close()
+	}
+	// a scan reads the other entries once, after the hot one
+	for _, key := range []string{"scan1", "scan2"} {
+		fc.Write(ctx, key, sampleReader(data))
+		r, err := fc.Read(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+
+	// the counts survive a restart
+	restarted := MustNew(Config{BaseDir: fc.BaseDir, TempDir: "tmp", MaxSize: int64(len(data)) * 2, EvictionPolicy: LFU}, nil)
+	if sc, _ := restarted.readSidecar("hot"); sc.Hits != 3 {
+		t.Fatal("access counts must be persisted", sc.Hits)
+	}
+	if _, err := restarted.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Has("hot") || restarted.Has("scan1") || !restarted.Has("scan2") {
+		t.Fatal("the least frequently accessed entry must be evicted")
+	}
+}
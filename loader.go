@@ -0,0 +1,91 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+const refreshTimeout = 5 * time.Minute
+
+// Loader fetches the content of key from the origin of the cache. It
+// returns an error matching fs.ErrNotExist when the origin does not have
+// key either.
+type Loader func(ctx context.Context, key string) (io.ReadCloser, error)
+
+// load fetches key with Config.Loader, caches it and serves the cached
+// copy. Concurrent loads of the same key share a single fetch.
+func (f *FileCache) load(ctx context.Context, key string) (io.ReadCloser, error) {
+	err := f.root.flights.do(ctx, f.keylock(key), func() error {
+		return f.fetch(ctx, key, WriteOptions{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.read(ctx, key, !f.DisableTouch)
+}
+
+// fetch writes the content of key loaded by Config.Loader with opts.
+func (f *FileCache) fetch(ctx context.Context, key string, opts WriteOptions) error {
+	src, err := f.Loader(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return f.fill(ctx, key, opts, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
+
+// refresh replaces the stale entry of key with a fresh copy from the
+// origin, unless it is being loaded already. Failures are only logged,
+// the stale entry is served until it outlives MaxStale.
+func (f *FileCache) refresh(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	err := f.root.flights.do(ctx, f.keylock(key), func() error {
+		return f.fetch(ctx, key, WriteOptions{Overwrite: true})
+	})
+	if err != nil {
+		f.Logger.WithError(err).WithField("key", key).Warn("Failed to refresh stale entry")
+	}
+}
+
+// staleWindow returns how long expired entries may be served while being
+// refreshed, see Config.MaxStale.
+func (f *FileCache) staleWindow() time.Duration {
+	if f.Loader == nil {
+		return 0
+	}
+	return f.MaxStale
+}
+
+// refreshDue reports whether the entry of key modified at modTime has less
+// than Config.RefreshAhead of its TTL left, but has not expired yet.
+func (f *FileCache) refreshDue(key string, modTime time.Time) bool {
+	if f.Loader == nil || f.RefreshAhead <= 0 {
+		return false
+	}
+	_, maxTTL := f.limits()
+	writtenAt, ttl := modTime, f.jitterTTL(key, maxTTL)
+	if sc, err := f.readSidecar(key); err == nil {
+		if sc.Pinned {
+			return false
+		}
+		if sc.ExpiresAt > 0 {
+			if sc.WrittenAt > 0 {
+				writtenAt = time.Unix(0, sc.WrittenAt)
+			}
+			ttl = time.Unix(0, sc.ExpiresAt).Sub(writtenAt)
+		}
+	}
+	left := ttl - time.Since(writtenAt)
+	return left > 0 && float64(left) < f.RefreshAhead*float64(ttl)
+}
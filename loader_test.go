@@ -0,0 +1,143 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+
+	var loads int32
+	origin := map[string]string{"remote": "ABC"}
+	loader := func(ctx context.Context, key string) (io.ReadCloser, error) {
+		atomic.AddInt32(&loads, 1)
+		data, ok := origin[key]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+	fc := MustNew(Config{TempDir: "tmp", Loader: loader}, nil)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 2; i++ {
+		r, err := fc.Read(ctx, "remote")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != "ABC" {
+			t.Fatal("data not match", string(data))
+		}
+	}
+	if loads != 1 || !fc.Has("remote") {
+		t.Fatal("a loaded key must be cached", loads)
+	}
+
+	if _, err := fc.Read(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("a key missing in the origin must not be found", err)
+	}
+	if _, ok, err := fc.TryRead(ctx, "missing"); ok || err != nil {
+		t.Fatal("TryRead must report a key missing in the origin as a miss", err)
+	}
+}
+
+func TestMaxStale(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, key string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("fresh")), nil
+	}
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, MaxStale: time.Hour, Loader: loader}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.WriteAt(ctx, "stale", sampleReader("stale"), time.Now().Add(-90*time.Minute))
+	fc.WriteAt(ctx, "old", sampleReader("stale"), time.Now().Add(-3*time.Hour))
+
+	evicted, _, err := fc.cleanCachedFileByTTL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 1 || !fc.Has("stale") || fc.Has("old") {
+		t.Fatal("the GC must keep entries expired for less than MaxStale", evicted)
+	}
+	fc.WriteAt(ctx, "old", sampleReader("stale"), time.Now().Add(-3*time.Hour))
+
+	read := func(key string) string {
+		r, err := fc.Read(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		data, _ := io.ReadAll(r)
+		return string(data)
+	}
+	if data := read("stale"); data != "stale" {
+		t.Fatal("a stale entry must be served right away", data)
+	}
+	deadline := time.Now().Add(time.Second)
+	for read("stale") != "fresh" {
+		if time.Now().After(deadline) {
+			t.Fatal("a stale entry must be refreshed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if data := read("old"); data != "fresh" {
+		t.Fatal("an entry expired for more than MaxStale must be loaded again", data)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	ctx := context.Background()
+
+	var loads int32
+	loader := func(ctx context.Context, key string) (io.ReadCloser, error) {
+		atomic.AddInt32(&loads, 1)
+		return io.NopCloser(strings.NewReader("fresh")), nil
+	}
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, RefreshAhead: 0.1, Loader: loader}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.WriteAt(ctx, "recent", sampleReader("old"), time.Now().Add(-30*time.Minute))
+	fc.WriteAt(ctx, "expiring", sampleReader("old"), time.Now().Add(-55*time.Minute))
+
+	read := func(key string) string {
+		r, err := fc.Read(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		data, _ := io.ReadAll(r)
+		return string(data)
+	}
+	if data := read("expiring"); data != "old" {
+		t.Fatal("an entry about to expire must be served while it is refreshed", data)
+	}
+	deadline := time.Now().Add(time.Second)
+	for read("expiring") != "fresh" {
+		if time.Now().After(deadline) {
+			t.Fatal("an entry about to expire must be refreshed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	before := atomic.LoadInt32(&loads)
+	read("recent")
+	time.Sleep(10 * time.Millisecond)
+	if after := atomic.LoadInt32(&loads); after != before {
+		t.Fatal("entries with enough TTL left must not be refreshed", after-before)
+	}
+
+	if _, err := New(Config{TempDir: "tmp", RefreshAhead: 1}, nil); err == nil {
+		t.Fatal("a refresh ahead fraction of 1 must be rejected")
+	}
+}
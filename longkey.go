@@ -0,0 +1,52 @@
+package filecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// hashedKeyPrefix is the name prefix of the files of hashed keys.
+const hashedKeyPrefix = "sha256-"
+
+// fileName returns the name of the file of key: the key encoded by the
+// KeyEncoder, or a hash of the key when its encoding is longer than
+// MaxKeyLength. Hashed names map to themselves, so entries listed by file
+// name can be addressed directly; validateKey rejects them as keys, so a
+// key can not alias the file of another one.
+func (f *FileCache) fileName(key string) string {
+	if isHashedName(key) {
+		return key
+	}
+	name := f.keyEncoder().Encode(key)
+	if f.MaxKeyLength > 0 && len(name) > f.MaxKeyLength {
+		return hashName(key)
+	}
+	return name
+}
+
+func hashName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func isHashedName(name string) bool {
+	if !strings.HasPrefix(name, hashedKeyPrefix) || len(name) != len(hashedKeyPrefix)+2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name[len(hashedKeyPrefix):])
+	return err == nil
+}
+
+// entryKey returns the key of the entry stored in the file of name, which
+// is read from the sidecar for hashed keys.
+func (f *FileCache) entryKey(name string) string {
+	if !isHashedName(name) {
+		return f.nameKey(name)
+	}
+	sc, err := f.readSidecar(name)
+	if err != nil || len(sc.Key) == 0 {
+		return name
+	}
+	return sc.Key
+}
@@ -0,0 +1,75 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMaxKeyLength(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxKeyLength: 64}, nil)
+	defer fc.Destroy(ctx)
+
+	longKey := "https://example.com/" + strings.Repeat("a", 300)
+	if err := fc.Write(ctx, longKey, sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Write(ctx, "short", sampleReader("DEF")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fc.BaseDir + "/short"); err != nil {
+		t.Fatal("short keys must keep their literal file name", err)
+	}
+
+	r, err := fc.Read(ctx, longKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "ABC" {
+		t.Fatal("content not match", string(data))
+	}
+
+	keys, _ := fc.Keys()
+	if len(keys) != 2 || keys[0] != "short" || keys[1] != longKey {
+		t.Fatal("keys must report the original key", keys)
+	}
+	if newest, _, _ := fc.Newest(ctx); newest != longKey {
+		t.Fatal("entry infos must report the original key", newest)
+	}
+
+	if err := fc.Delete(ctx, longKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fc.Read(ctx, longKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("long key must be deleted", err)
+	}
+}
+
+func TestHashedNameKeyRejected(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxKeyLength: 64}, nil)
+	defer fc.Destroy(ctx)
+
+	longKey := strings.Repeat("a", 300)
+	if err := fc.Write(ctx, longKey, sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	alias := hashName(longKey)
+	if _, err := fc.Read(ctx, alias); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal("a key must not alias the hashed file of another key", err)
+	}
+	if err := fc.WriteWithOptions(ctx, alias, sampleReader("DEF"), WriteOptions{Overwrite: true}); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal("a key must not overwrite the hashed file of another key", err)
+	}
+	if err := fc.Delete(ctx, alias); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal("a key must not delete the hashed file of another key", err)
+	}
+}
@@ -0,0 +1,26 @@
+module github.com/mobile-health/filecache/metrics
+
+go 1.18
+
+require (
+	github.com/mobile-health/filecache v0.0.0-20261016030512-48b52925f5d9
+	github.com/prometheus/client_golang v1.14.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.3.0 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	github.com/sirupsen/logrus v1.9.0 // indirect
+	golang.org/x/sys v0.0.0-20220919091848-fb04ddd9f9c8 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+// The parent module is used from the working tree when developing in this
+// repository, consumers of this module get the version required above.
+replace github.com/mobile-health/filecache => ../
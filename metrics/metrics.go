@@ -0,0 +1,106 @@
+// Package metrics exports the metrics of a cache to Prometheus.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mobile-health/filecache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	bytesDesc = prometheus.NewDesc("filecache_bytes",
+		"Bytes stored by the cache and its namespaces.", nil, nil)
+	entriesDesc = prometheus.NewDesc("filecache_entries",
+		"Entries stored by the cache and its namespaces.", nil, nil)
+	evictionsDesc = prometheus.NewDesc("filecache_evictions_total",
+		"Entries evicted, by strategy.", []string{"strategy"}, nil)
+)
+
+// Collector is a prometheus.Collector of the metrics of a cache, its
+// namespaces included.
+type Collector struct {
+	fc *filecache.FileCache
+
+	hits       prometheus.Counter
+	misses     prometheus.Counter
+	latency    *prometheus.HistogramVec
+	gcDuration prometheus.Histogram
+}
+
+// New returns a collector of the metrics of fc, which it instruments to
+// count hits and misses and time operations. Use a prometheus.Registerer
+// wrapped with labels to collect several caches.
+func New(fc *filecache.FileCache) *Collector {
+	c := &Collector{
+		fc: fc,
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "filecache_hits_total",
+			Help: "Reads served from the cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "filecache_misses_total",
+			Help: "Reads of keys missing from the cache, including those then served from the fallback cache or the loader.",
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "filecache_operation_duration_seconds",
+			Help:    "Duration of reads, writes and deletes.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"op"}),
+		gcDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "filecache_gc_duration_seconds",
+			Help:    "Duration of GC runs.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		}),
+	}
+	fc.Instrument(c)
+	return c
+}
+
+// StartOp implements filecache.Instrument.
+func (c *Collector) StartOp(ctx context.Context, op filecache.Op) (context.Context, func(filecache.OpResult)) {
+	start := time.Now()
+	return ctx, func(result filecache.OpResult) {
+		elapsed := time.Since(start).Seconds()
+		if op.Name == "gc" {
+			c.gcDuration.Observe(elapsed)
+			return
+		}
+		c.latency.WithLabelValues(op.Name).Observe(elapsed)
+		if op.Name != "read" {
+			return
+		}
+		if result.Hit {
+			c.hits.Inc()
+		} else if result.Err == nil || errors.Is(result.Err, filecache.ErrKeyNotFound) {
+			c.misses.Inc()
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bytesDesc
+	ch <- entriesDesc
+	ch <- evictionsDesc
+	c.hits.Describe(ch)
+	c.misses.Describe(ch)
+	c.latency.Describe(ch)
+	c.gcDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.fc.Stats()
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.GaugeValue, float64(stats.Bytes))
+	ch <- prometheus.MustNewConstMetric(entriesDesc, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(stats.EvictTTL), "ttl")
+	ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(stats.EvictSize), "lru")
+
+	c.hits.Collect(ch)
+	c.misses.Collect(ch)
+	c.latency.Collect(ch)
+	c.gcDuration.Collect(ch)
+}
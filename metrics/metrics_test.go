@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mobile-health/filecache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+
+	fc := filecache.MustNew(filecache.Config{BaseDir: "filecache", TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	c := New(fc)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.Write(ctx, "key", strings.NewReader("ABC"))
+	fc.Namespace("ns").Write(ctx, "key", strings.NewReader("DEFG"))
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+
+	if hits, misses := testutil.ToFloat64(c.hits), testutil.ToFloat64(c.misses); hits != 1 || misses != 1 {
+		t.Fatal("reads must be counted as hits and misses", hits, misses)
+	}
+	expected := `
+# HELP filecache_bytes Bytes stored by the cache and its namespaces.
+# TYPE filecache_bytes gauge
+filecache_bytes 7
+# HELP filecache_entries Entries stored by the cache and its namespaces.
+# TYPE filecache_entries gauge
+filecache_entries 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "filecache_bytes", "filecache_entries"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c, "filecache_operation_duration_seconds"); n != 2 {
+		t.Fatal("reads and writes must be timed", n)
+	}
+}
@@ -0,0 +1,152 @@
+package filecache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// namespaceMarker is the file marking the directory of a namespace, so the
+// GC of a later process can find it.
+const namespaceMarker = internalFilePrefix + "namespace"
+
+// Namespace returns a view of the cache rooted at BaseDir/name. The view
+// shares the config, the lock factory and the logger of its parent, and its
+// files are swept by the GC of the root cache. Empty, Keys and Size of a
+// namespace only operate within its own subtree.
+//
+// Calling Namespace several times with the same name returns the same view.
+// It panics where OpenNamespace returns an error.
+func (f *FileCache) Namespace(name string) *FileCache {
+	ns, err := f.OpenNamespace(name)
+	if err != nil {
+		panic(err)
+	}
+	return ns
+}
+
+// OpenNamespace is Namespace, it returns an error when name is not a valid
+// directory name or the directory of the namespace can not be set up.
+func (f *FileCache) OpenNamespace(name string) (*FileCache, error) {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || isInternalFile(name) {
+		return nil, fmt.Errorf("invalid namespace %q", name)
+	}
+
+	namespace := name
+	if len(f.namespace) > 0 {
+		namespace = f.namespace + "/" + name
+	}
+
+	root := f.root
+	root.nsMutex.Lock()
+	defer root.nsMutex.Unlock()
+
+	if root.namespaces == nil {
+		root.namespaces = map[string]*FileCache{}
+	}
+	if ns, ok := root.namespaces[namespace]; ok {
+		return ns, nil
+	}
+
+	// UpdateLimits writes the limits under limitsMutex
+	f.limitsMutex.RLock()
+	config := f.Config
+	f.limitsMutex.RUnlock()
+	ns := &FileCache{
+		Config:       config,
+		lockFactory:  f.lockFactory,
+		quit:         root.quit,
+		gcCtx:        root.gcCtx,
+		gcCancel:     root.gcCancel,
+		admission:    root.admission,
+		commitMutex:  root.commitMutex,
+		sidecarMutex: root.sidecarMutex,
+		trigger:      root.trigger,
+		usage:        &sizeCounter{},
+		Logger:       f.Logger,
+		namespace:    namespace,
+		root:         root,
+	}
+	if dir, err := ensureDir(filepath.Join(f.BaseDir, name)); err != nil {
+		return nil, err
+	} else {
+		ns.BaseDir = dir
+	}
+	if err := markNamespace(ns.BaseDir); err != nil {
+		return nil, err
+	}
+	if f.TinyLFU {
+		ns.frequency = newSketch()
+	}
+	ns.misses = newTombstones(f.NegativeTTL)
+	if f.InMemoryIndex {
+		ns.index = &index{}
+		if err := ns.loadIndex(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	root.namespaces[namespace] = ns
+	return ns, nil
+}
+
+// markNamespace creates the marker of the namespace directory dir.
+func markNamespace(dir string) error {
+	file, err := os.OpenFile(filepath.Join(dir, namespaceMarker), os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// discoverNamespaces opens the namespaces of the cache found on disk, such
+// as those created by a previous process, so the GC sweeps them too.
+func (f *FileCache) discoverNamespaces(ctx context.Context) error {
+	entries, err := os.ReadDir(f.BaseDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(f.BaseDir, entry.Name(), namespaceMarker)); err != nil {
+			continue
+		}
+		ns, err := f.OpenNamespace(entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := ns.discoverNamespaces(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Namespaces returns every namespace created under the cache, including
+// nested ones, ordered by name.
+func (f *FileCache) Namespaces() []*FileCache {
+	root := f.root
+	root.nsMutex.Lock()
+	defer root.nsMutex.Unlock()
+
+	var names []string
+	for name := range root.namespaces {
+		if len(f.namespace) == 0 || strings.HasPrefix(name, f.namespace+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := make([]*FileCache, 0, len(names))
+	for _, name := range names {
+		list = append(list, root.namespaces[name])
+	}
+	return list
+}
@@ -0,0 +1,118 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	thumbs := fc.Namespace("thumbs")
+	if thumbs != fc.Namespace("thumbs") {
+		t.Fatal("must return the same namespace")
+	}
+	if thumbs.BaseDir != filepath.Join(fc.BaseDir, "thumbs") {
+		t.Fatal("namespace must be rooted under BaseDir")
+	}
+
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := thumbs.Write(ctx, "key", sampleReader("ABCDEF")); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := fc.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "key" {
+		t.Fatal("root keys must not include namespaces")
+	}
+	if size, _ := fc.Size(); size != 3 {
+		t.Fatal("root size must not include namespaces")
+	}
+	if size, _ := thumbs.Size(); size != 6 {
+		t.Fatal("namespace size must only count its own files")
+	}
+
+	if err := thumbs.Empty(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("key") || !existDir(fc.TempDir) {
+		t.Fatal("emptying a namespace must not affect the root")
+	}
+}
+
+func TestNamespaceGC(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Minute}, nil)
+	defer fc.Empty(ctx)
+
+	thumbs := fc.Namespace("thumbs")
+	if err := thumbs.Write(ctx, "key1", sampleReader("ABC1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := thumbs.Write(ctx, "key2", sampleReader("ABC2")); err != nil {
+		t.Fatal(err)
+	}
+	thumbs.touch("key1", time.Now().Add(-time.Hour))
+
+	if _, err := fc.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if thumbs.Has("key1") || !thumbs.Has("key2") {
+		t.Fatal("root GC must sweep namespaces")
+	}
+}
+
+func TestOpenNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	for _, name := range []string{"", "..", "a/b", shardDirName} {
+		if _, err := fc.OpenNamespace(name); err == nil {
+			t.Fatal("invalid namespace must be rejected", name)
+		}
+	}
+	ns, err := fc.OpenNamespace("thumbs")
+	if err != nil || ns != fc.Namespace("thumbs") {
+		t.Fatal("must open the namespace", err)
+	}
+}
+
+func TestGCSweepsNamespacesOnDisk(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour}, nil)
+	defer fc.Destroy(ctx)
+
+	nested := fc.Namespace("thumbs").Namespace("small")
+	nested.Write(ctx, "key", sampleReader("ABC"))
+	fc.Namespace("thumbs").Flush(ctx)
+	nested.Write(ctx, "key", sampleReader("ABC"))
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(nested.absFilePath("key"), old, old)
+
+	restarted := MustNew(Config{BaseDir: fc.BaseDir, TempDir: "tmp", MaxTTL: time.Hour}, nil)
+	report, err := restarted.CleanNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TTLEvicted != 1 || nested.Has("key") {
+		t.Fatal("namespaces created by a previous process must be swept", report.TTLEvicted)
+	}
+	if len(restarted.Namespaces()) != 2 {
+		t.Fatal("namespaces on disk must be opened", restarted.Namespaces())
+	}
+}
@@ -0,0 +1,71 @@
+package filecache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTombstones bounds the memory of the negative cache, expired
+// tombstones are dropped when it is reached, and all of them if none is.
+const maxTombstones = 65536
+
+// tombstones remember keys recently found missing, see Config.NegativeTTL.
+// A nil *tombstones remembers nothing.
+type tombstones struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	expires map[string]time.Time
+}
+
+func newTombstones(ttl time.Duration) *tombstones {
+	if ttl <= 0 {
+		return nil
+	}
+	return &tombstones{ttl: ttl, expires: map[string]time.Time{}}
+}
+
+// add records that key is missing.
+func (t *tombstones) add(key string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if len(t.expires) >= maxTombstones {
+		for k, expiresAt := range t.expires {
+			if now.After(expiresAt) {
+				delete(t.expires, k)
+			}
+		}
+		if len(t.expires) >= maxTombstones {
+			t.expires = map[string]time.Time{}
+		}
+	}
+	t.expires[key] = now.Add(t.ttl)
+}
+
+// has reports whether key was found missing less than the TTL ago.
+func (t *tombstones) has(key string) bool {
+	if t == nil {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	expiresAt, ok := t.expires[key]
+	if ok && time.Now().After(expiresAt) {
+		delete(t.expires, key)
+		return false
+	}
+	return ok
+}
+
+// remove forgets that key is missing, once it is written.
+func (t *tombstones) remove(key string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.expires, key)
+}
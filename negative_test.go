@@ -0,0 +1,63 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+
+	var loads int32
+	loader := func(ctx context.Context, key string) (io.ReadCloser, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, fs.ErrNotExist
+	}
+	fc := MustNew(Config{TempDir: "tmp", Loader: loader, NegativeTTL: 50 * time.Millisecond}, nil)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 3; i++ {
+		if _, err := fc.Read(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatal("must not found", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatal("a key found missing must not be loaded again", loads)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := fc.Read(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) || loads != 2 {
+		t.Fatal("a key must be loaded again once its tombstone expired", err, loads)
+	}
+
+	if err := fc.Write(ctx, "missing", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("missing") {
+		t.Fatal("a write must forget that the key is missing")
+	}
+	r, err := fc.Read(ctx, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestTombstonesBounded(t *testing.T) {
+	misses := newTombstones(time.Hour)
+	for i := 0; i <= maxTombstones; i++ {
+		misses.add(strconv.Itoa(i))
+	}
+	if len(misses.expires) > maxTombstones {
+		t.Fatal("tombstones must be bounded", len(misses.expires))
+	}
+	if newTombstones(0).has("key") {
+		t.Fatal("a disabled negative cache must not report misses")
+	}
+}
@@ -0,0 +1,71 @@
+package filecache
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a cache opened with Open.
+type Option func(*options)
+
+type options struct {
+	config      Config
+	lockFactory ILockFatory
+	logger      *logrus.Logger
+}
+
+// WithMaxSize sets Config.MaxSize.
+func WithMaxSize(maxSize int64) Option {
+	return func(o *options) { o.config.MaxSize = maxSize }
+}
+
+// WithTTL sets Config.MaxTTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) { o.config.MaxTTL = ttl }
+}
+
+// WithTempDir sets Config.TempDir.
+func WithTempDir(dir string) Option {
+	return func(o *options) { o.config.TempDir = dir }
+}
+
+// WithCleanupInterval sets Config.CleanupInterval.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(o *options) { o.config.CleanupInterval = interval }
+}
+
+// WithLockFactory makes the cache lock keys through lockFactory.
+func WithLockFactory(lockFactory ILockFatory) Option {
+	return func(o *options) { o.lockFactory = lockFactory }
+}
+
+// WithLogger makes the cache log to logger instead of its own logger, the
+// log settings of Config are then ignored.
+func WithLogger(logger *logrus.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithConfig applies fn to the configuration, for the settings without an
+// option of their own.
+func WithConfig(fn func(config *Config)) Option {
+	return func(o *options) { fn(&o.config) }
+}
+
+// Open creates a cache in dir configured by opts, like New does with a
+// Config. Options keep working as the cache gains settings, unlike
+// positional Config literals.
+func Open(dir string, opts ...Option) (*FileCache, error) {
+	o := options{config: Config{BaseDir: dir}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	fc, err := New(o.config, o.lockFactory)
+	if err != nil {
+		return nil, err
+	}
+	if o.logger != nil {
+		fc.Logger = o.logger
+	}
+	return fc, nil
+}
@@ -0,0 +1,45 @@
+package filecache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	lockFactory := &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}}
+	logger := logrus.New()
+
+	fc, err := Open("filecache_open",
+		WithTempDir("tmp"),
+		WithMaxSize(1024),
+		WithTTL(time.Minute),
+		WithCleanupInterval(time.Hour),
+		WithLockFactory(lockFactory),
+		WithLogger(logger),
+		WithConfig(func(config *Config) { config.LazyExpire = true }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.Destroy(ctx)
+
+	config := fc.EffectiveConfig()
+	if config.MaxSize != 1024 || config.MaxTTL != time.Minute || config.CleanupInterval != time.Hour || !config.LazyExpire {
+		t.Fatal("options must be applied", config)
+	}
+	if fc.lockFactory != lockFactory || fc.Logger != logger {
+		t.Fatal("lock factory and logger must be used")
+	}
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open("filecache_open", WithMaxSize(-1)); err == nil {
+		t.Fatal("invalid options must be rejected")
+	}
+}
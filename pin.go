@@ -0,0 +1,40 @@
+package filecache
+
+import "context"
+
+// Pin keeps the entry of key from being evicted: the GC skips it even past
+// MaxTTL or when the cache is over MaxSize. The pin is recorded in the
+// sidecar of the entry, so it survives restarts and overwrites of the
+// entry, and is removed along with the entry by Delete.
+func (f *FileCache) Pin(ctx context.Context, key string) error {
+	return opError("pin", key, f.setPinned(ctx, key, true))
+}
+
+// Unpin lets the entry of key be evicted again.
+func (f *FileCache) Unpin(ctx context.Context, key string) error {
+	return opError("unpin", key, f.setPinned(ctx, key, false))
+}
+
+func (f *FileCache) setPinned(ctx context.Context, key string, pinned bool) error {
+	if err := f.validateKey(key); err != nil {
+		return err
+	}
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.keylock(key))
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	if _, err := f.hasFile(ctx, key); err != nil {
+		return err
+	}
+	return f.updateSidecar(ctx, key, func(sc *sidecar) { sc.Pinned = pinned })
+}
+
+// pinned reports whether the entry stored in the file of name is pinned.
+func (f *FileCache) pinned(name string) bool {
+	sc, err := f.readSidecar(f.nameKey(name))
+	return err == nil && sc.Pinned
+}
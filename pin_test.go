@@ -0,0 +1,99 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)), MaxTTL: time.Minute}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Pin(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("must not pin a missing key", err)
+	}
+
+	fc.Write(ctx, "expired", sampleReader(data))
+	fc.Write(ctx, "oldest", sampleReader(data))
+	fc.Write(ctx, "newest", sampleReader(data))
+	fc.touch("expired", time.Now().Add(-time.Hour))
+	fc.touch("oldest", time.Now().Add(-time.Second))
+	for _, key := range []string{"expired", "oldest"} {
+		if err := fc.Pin(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pins survive overwrites
+	fc.WriteWithOptions(ctx, "oldest", sampleReader(data), WriteOptions{ModTime: time.Now().Add(-time.Second), Overwrite: true})
+
+	if _, err := fc.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Has("expired") || !fc.Has("oldest") {
+		t.Fatal("pinned entries must survive the GC")
+	}
+	if fc.Has("newest") {
+		t.Fatal("unpinned entry must be evicted")
+	}
+
+	if err := fc.Unpin(ctx, "expired"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fc.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("expired") || !fc.Has("oldest") {
+		t.Fatal("unpinned entry must be evicted again")
+	}
+}
+
+func TestCacheFull(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)), EvictBeforeWrite: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "pinned", sampleReader(data))
+	fc.Pin(ctx, "pinned")
+
+	err := fc.Write(ctx, "key", sampleReader(data))
+	var opErr *OpError
+	if !errors.Is(err, ErrCacheFull) || !errors.As(err, &opErr) || opErr.Key != "key" {
+		t.Fatal("write must fail with ErrCacheFull when only pinned entries are left", err)
+	}
+	if fc.Has("key") || !fc.Has("pinned") {
+		t.Fatal("pinned entry must not be evicted")
+	}
+	if _, err := fc.Stat(ctx, "key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("missing key must match ErrKeyNotFound", err)
+	}
+}
+
+func TestPinRestart(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Minute, LazyExpire: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	if err := fc.Pin(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	fc.touch("key", time.Now().Add(-time.Hour))
+
+	restarted := MustNew(Config{BaseDir: fc.BaseDir, TempDir: "tmp", MaxTTL: time.Minute, LazyExpire: true, InMemoryIndex: true}, nil)
+	if _, err := restarted.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r, err := restarted.Read(ctx, "key")
+	if err != nil {
+		t.Fatal("pins must survive restarts", err)
+	}
+	r.Close()
+}
@@ -0,0 +1,281 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// EvictionPolicy picks the entries the GC evicts. Candidates returns the
+// keys to evict, in order, from the state of the cache; keys which are not
+// in the state are ignored. Pinned entries and entries younger than
+// Config.MinEvictAge are never handed to a policy.
+type EvictionPolicy interface {
+	Candidates(ctx context.Context, state EvictionState) []string
+}
+
+// EvictionState is the state of a cache handed to an EvictionPolicy.
+type EvictionState struct {
+	// Entries are the entries which may be evicted, least recently used
+	// first: pinned entries and those younger than MinEvictAge are left
+	// out.
+	Entries []EntryInfo
+	// Size and Count are the total size and number of the entries, pinned
+	// ones included.
+	Size       int64
+	Count      int
+	MaxSize    int64
+	MaxEntries int
+	MaxTTL     time.Duration
+
+	expired map[string]bool
+	hits    map[string]int64
+}
+
+// Expired reports whether entry outlived its TTL, its own one if it was
+// written with one.
+func (s EvictionState) Expired(entry EntryInfo) bool {
+	return s.expired[entry.Key]
+}
+
+// Hits returns the number of accesses of entry, which are only counted
+// when Config.PersistAccessCount is set.
+func (s EvictionState) Hits(entry EntryInfo) int64 {
+	return s.hits[entry.Key]
+}
+
+// fits reports whether a cache of size bytes and count entries is within
+// the limits of the state.
+func (s EvictionState) fits(size int64, count int) bool {
+	return size <= s.MaxSize && (s.MaxEntries <= 0 || count <= s.MaxEntries)
+}
+
+// TTLLRU is the default eviction policy: it evicts the expired entries,
+// then the least recently used ones until the cache fits within MaxSize
+// and MaxEntries.
+var TTLLRU EvictionPolicy = ttlLRU{}
+
+type ttlLRU struct{}
+
+func (ttlLRU) Candidates(ctx context.Context, state EvictionState) []string {
+	var keys []string
+	size, count := state.Size, state.Count
+	for _, entry := range state.Entries {
+		if state.Expired(entry) {
+			keys = append(keys, entry.Key)
+			size, count = size-entry.Size, count-1
+		}
+	}
+	for _, entry := range state.Entries {
+		if state.fits(size, count) {
+			break
+		}
+		if !state.Expired(entry) {
+			keys = append(keys, entry.Key)
+			size, count = size-entry.Size, count-1
+		}
+	}
+	return keys
+}
+
+// ttlOnly evicts the expired entries.
+type ttlOnly struct{}
+
+func (ttlOnly) Candidates(ctx context.Context, state EvictionState) []string {
+	var keys []string
+	for _, entry := range state.Entries {
+		if state.Expired(entry) {
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys
+}
+
+func (fc *FileCache) evictionPolicy() EvictionPolicy {
+	if fc.EvictionPolicy == nil {
+		return TTLLRU
+	}
+	return fc.EvictionPolicy
+}
+
+// gcBatch is a batch of GC deletions made holding the global lock.
+type gcBatch struct {
+	lock  ILock
+	count int
+}
+
+// nextInBatch accounts for one more deletion of the GC, taking the global
+// lock at the start of a batch and releasing it once the batch is full.
+func (fc *FileCache) nextInBatch(ctx context.Context, batch *gcBatch) error {
+	if fc.lockFactory == nil {
+		return nil
+	}
+	if batch.count == fc.GCBatchSize {
+		batch.end(ctx)
+	}
+	if batch.lock == nil {
+		lock, err := fc.lockFactory.Lock(ctx, fc.LockNamespace)
+		if err != nil {
+			return err
+		}
+		batch.lock = lock
+	}
+	batch.count++
+	return nil
+}
+
+// end releases the global lock held by the batch, if any.
+func (b *gcBatch) end(ctx context.Context) {
+	if b.lock != nil {
+		b.lock.Unlock(ctx)
+	}
+	b.lock, b.count = nil, 0
+}
+
+// evict deletes the entries picked by policy. The deletions are made in
+// batches of GCBatchSize, each holding the global lock, and paced by
+// throttle, which waits with the lock released. Expired entries count as
+// evicted by TTL, the others by LRU. It returns what was evicted, also when
+// it fails part way, and the number of entries examined.
+func (fc *FileCache) evict(ctx context.Context, policy EvictionPolicy, throttle *gcThrottle) (result GCResult, scanned int, err error) {
+	state, err := fc.evictionState(ctx)
+	if err != nil {
+		return result, 0, err
+	}
+	scanned = state.Count
+	sizes := make(map[string]int64, len(state.Entries))
+	for _, entry := range state.Entries {
+		sizes[entry.Key] = entry.Size
+	}
+	defer func() {
+		result.BytesFreed = result.TTLBytesFreed + result.LRUBytesFreed
+		fc.root.evictions.addTTL(result.TTLEvicted, result.TTLBytesFreed)
+		fc.root.evictions.addLRU(result.LRUEvicted, result.LRUBytesFreed)
+	}()
+
+	var batch gcBatch
+	defer batch.end(ctx)
+	for _, key := range policy.Candidates(ctx, state) {
+		if err := ctx.Err(); err != nil {
+			return result, scanned, err
+		}
+		size, ok := sizes[key]
+		if !ok {
+			continue
+		}
+		delete(sizes, key)
+		if d := throttle.delay(time.Now()); d > 0 {
+			batch.end(ctx)
+			if err := throttle.wait(ctx, d); err != nil {
+				return result, scanned, err
+			}
+		}
+		if err := fc.nextInBatch(ctx, &batch); err != nil {
+			return result, scanned, err
+		}
+		reason := ReasonLRU
+		if state.expired[key] {
+			reason = ReasonTTL
+		}
+		if err := fc.delete(ctx, key, reason); errors.Is(err, ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return result, scanned, err
+		}
+		throttle.deleted(size)
+		strategy := "LRU"
+		if state.expired[key] {
+			strategy = "TTL"
+			result.TTLEvicted++
+			result.TTLBytesFreed += size
+		} else {
+			result.LRUEvicted++
+			result.LRUBytesFreed += size
+		}
+		fc.Logger.WithField("strategy", strategy).Debugf("Cleaned cache file %s", key)
+	}
+	fc.Logger.WithField("strategy", "TTL").Infof("Cleaned %d files, %d bytes", result.TTLEvicted, result.TTLBytesFreed)
+	fc.Logger.WithField("strategy", "LRU").Infof("Cleaned %d files, %d bytes", result.LRUEvicted, result.LRUBytesFreed)
+	size := state.Size - result.TTLBytesFreed - result.LRUBytesFreed
+	count := state.Count - result.TTLEvicted - result.LRUEvicted
+	if !state.fits(size, count) && policy == TTLLRU {
+		fc.Logger.WithField("strategy", "LRU").Warnf("Cache is still over its limits with %d entries of %d bytes, the remaining entries are pinned or too young", count, size)
+	}
+	return result, scanned, nil
+}
+
+// evictionState lists the entries of the cache for an eviction policy.
+func (fc *FileCache) evictionState(ctx context.Context) (EvictionState, error) {
+	files, err := fc.files(ctx)
+	if err != nil {
+		return EvictionState{}, err
+	}
+	var sidecars map[string]bool
+	if fc.index == nil {
+		if sidecars, err = fc.sidecarNames(ctx); err != nil {
+			return EvictionState{}, err
+		}
+	}
+	if fc.PersistAccessTime {
+		fc.sortByAccessTime(files)
+	}
+
+	state := EvictionState{expired: map[string]bool{}, hits: map[string]int64{}}
+	state.MaxSize, state.MaxTTL = fc.limits()
+	state.MaxEntries = fc.MaxEntries
+	now := time.Now()
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return EvictionState{}, err
+		}
+		state.Size += file.Size()
+		state.Count++
+		sc := fc.fileSidecar(file, sidecars)
+		if sc.Pinned || fc.tooYoung(file, now) {
+			continue
+		}
+		entry := fc.newEntryInfo(file)
+		state.Entries = append(state.Entries, entry)
+		expired := fc.expiredAfter(entry.Key, file.ModTime(), state.MaxTTL+fc.staleWindow())
+		if sc.ExpiresAt > 0 {
+			expired = sc.expiredAt(now.Add(-fc.staleWindow()))
+		}
+		if expired {
+			state.expired[entry.Key] = true
+		}
+		if sc.Hits > 0 {
+			state.hits[entry.Key] = sc.Hits
+		}
+	}
+	if target, ok, err := fc.watermarkTarget(state.Size); err != nil {
+		return EvictionState{}, err
+	} else if ok {
+		state.MaxSize = target
+	}
+	if deficit, err := fc.freeSpaceDeficit(); err != nil {
+		return EvictionState{}, err
+	} else if deficit > 0 && state.Size-deficit < state.MaxSize {
+		state.MaxSize = state.Size - deficit
+	}
+	return state, nil
+}
+
+// fileSidecar returns the sidecar of the entry of file, taken from the
+// in-memory index or only read for names listed in sidecars.
+func (fc *FileCache) fileSidecar(file fs.FileInfo, sidecars map[string]bool) sidecar {
+	if entry, ok := file.(indexEntry); ok {
+		return entry.sidecar()
+	}
+	if !sidecars[file.Name()] {
+		return sidecar{}
+	}
+	sc, _ := fc.readSidecar(fc.nameKey(file.Name()))
+	return sc
+}
+
+// tooYoung reports whether the entry of file was written or read less than
+// Config.MinEvictAge before now.
+func (fc *FileCache) tooYoung(file fs.FileInfo, now time.Time) bool {
+	return fc.MinEvictAge > 0 && now.Sub(file.ModTime()) < fc.MinEvictAge
+}
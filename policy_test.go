@@ -0,0 +1,168 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type largestFirst struct {
+	state EvictionState
+}
+
+func (p *largestFirst) Candidates(ctx context.Context, state EvictionState) []string {
+	p.state = state
+	var largest EntryInfo
+	for _, entry := range state.Entries {
+		if entry.Size > largest.Size {
+			largest = entry
+		}
+	}
+	return []string{largest.Key, "unknown"}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	policy := &largestFirst{}
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: 1, EvictionPolicy: policy}, nil)
+	defer fc.Destroy(ctx)
+
+	for key, content := range map[string]string{"small": "A", "large": "ABCDEF", "pinned": "ABCDEFGHIJ"} {
+		if err := fc.Write(ctx, key, sampleReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fc.Pin(ctx, "pinned"); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(fc.absFilePath("large"), old, old)
+
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LRUEvicted != 1 || result.BytesFreed != 6 {
+		t.Fatal("the candidates of the policy must be evicted", result)
+	}
+	if fc.Has("large") || !fc.Has("small") || !fc.Has("pinned") {
+		t.Fatal("only the largest entry must be evicted")
+	}
+
+	state := policy.state
+	if state.Size != 17 || state.MaxSize != 1 || len(state.Entries) != 2 {
+		t.Fatal("state must hold the unpinned entries and the total size", state)
+	}
+	if state.Entries[0].Key != "large" {
+		t.Fatal("entries must be ordered least recently used first", state.Entries)
+	}
+}
+
+func TestTTLLRU(t *testing.T) {
+	state := EvictionState{
+		Entries: []EntryInfo{{Key: "a", Size: 2}, {Key: "b", Size: 2}, {Key: "c", Size: 2}},
+		Size:    6,
+		MaxSize: 3,
+		expired: map[string]bool{"c": true},
+	}
+	keys := TTLLRU.Candidates(context.Background(), state)
+	if len(keys) != 2 || keys[0] != "c" || keys[1] != "a" {
+		t.Fatal("expired entries must be evicted first, then the least recently used", keys)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxEntries: 2}, nil)
+	defer fc.Destroy(ctx)
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		if err := fc.Write(ctx, key, sampleReader("ABC")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LRUEvicted != 1 || fc.Has("key1") || !fc.Has("key2") || !fc.Has("key3") {
+		t.Fatal("the oldest entries over MaxEntries must be evicted", result)
+	}
+}
+
+func TestMinEvictAge(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)), MinEvictAge: time.Minute}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "old", sampleReader(data))
+	fc.Write(ctx, "fresh1", sampleReader(data))
+	fc.Write(ctx, "fresh2", sampleReader(data))
+	fc.touch("old", time.Now().Add(-time.Hour))
+
+	if _, err := fc.cleanCachedFiles(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("old") || !fc.Has("fresh1") || !fc.Has("fresh2") {
+		t.Fatal("entries younger than MinEvictAge must not be evicted")
+	}
+}
+
+type countingLockFactory struct {
+	*LockFactory
+	counts map[string]int
+}
+
+func (fac *countingLockFactory) Lock(ctx context.Context, key string) (ILock, error) {
+	fac.mutex.Lock()
+	fac.counts[key]++
+	fac.mutex.Unlock()
+	return fac.LockFactory.Lock(ctx, key)
+}
+
+func TestEvictInBatches(t *testing.T) {
+	ctx := context.Background()
+
+	lockFactory := &countingLockFactory{
+		LockFactory: &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}},
+		counts:      map[string]int{},
+	}
+	var fc *FileCache
+	locked := 0
+	fc = MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, GCBatchSize: 2, Hooks: Hooks{
+		OnEvict: func(key string, size int64, reason Reason) {
+			if lockFactory.Has(ctx, fc.LockNamespace) {
+				locked++
+			}
+		},
+	}}, lockFactory)
+	defer fc.Destroy(ctx)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for i := 0; i < 5; i++ {
+		key := "key" + strconv.Itoa(i)
+		fc.Write(ctx, key, sampleReader("ABC"))
+		os.Chtimes(fc.absFilePath(key), old, old)
+	}
+
+	report, err := fc.CleanNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TTLEvicted != 5 || locked != 5 {
+		t.Fatal("entries must be evicted holding the global lock", report.TTLEvicted, locked)
+	}
+	if n := lockFactory.counts[fc.LockNamespace]; n != 3 {
+		t.Fatal("global lock must be taken once per batch", n)
+	}
+	if lockFactory.Has(ctx, fc.LockNamespace) {
+		t.Fatal("global lock must be released after the run")
+	}
+}
@@ -0,0 +1,54 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrRangeNotSatisfiable is returned when a range starts outside of the
+// entry.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ReadRange returns a reader of length bytes of the entry of key starting
+// at offset, or of the bytes up to the end of the entry when length is
+// negative. A range running past the end of the entry is cut short. It
+// counts as an access like Read.
+func (f *FileCache) ReadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	r, err := f.readRange(ctx, key, offset, length)
+	return r, opError("read", key, err)
+}
+
+func (f *FileCache) readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, err
+	}
+	r, err := f.read(ctx, key, !f.DisableTouch)
+	if err != nil {
+		return nil, err
+	}
+	file := r.(*os.File)
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if offset < 0 || offset > info.Size() {
+		file.Close()
+		return nil, ErrRangeNotSatisfiable
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &rangeReader{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,48 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key", sampleReader("ABCDEF"))
+
+	for _, c := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 3, "ABC"},
+		{2, 2, "CD"},
+		{4, -1, "EF"},
+		{4, 10, "EF"},
+		{6, -1, ""},
+	} {
+		r, err := fc.ReadRange(ctx, "key", c.offset, c.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != c.want {
+			t.Fatal("range not match", c.offset, c.length, string(data))
+		}
+	}
+
+	if _, err := fc.ReadRange(ctx, "key", 7, 1); !errors.Is(err, ErrRangeNotSatisfiable) {
+		t.Fatal("range past the end must not be satisfiable", err)
+	}
+	if _, err := fc.ReadRange(ctx, "key", -1, 1); !errors.Is(err, ErrRangeNotSatisfiable) {
+		t.Fatal("negative offset must not be satisfiable", err)
+	}
+	if _, err := fc.ReadRange(ctx, "missing", 0, 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("missing key must not be found", err)
+	}
+}
@@ -0,0 +1,119 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// orphanGracePeriod is the age under which an entry without sidecar may be
+// a write in progress, and is not deemed orphaned.
+const orphanGracePeriod = time.Minute
+
+// ReconcileReport tells how far the sidecars had drifted from the entries.
+type ReconcileReport struct {
+	// OrphanedSidecars is the number of sidecars removed because their
+	// entry no longer exists.
+	OrphanedSidecars int
+	// CorruptSidecars are the keys, prefixed by their namespace path, whose
+	// sidecar can not be decoded. They are reported but left in place.
+	CorruptSidecars []string
+	// OrphanedFiles is the number of entries of hashed keys removed because
+	// their sidecar, which holds their key, no longer exists: they could
+	// never be read again.
+	OrphanedFiles int
+}
+
+// Reconcile pairs the entries of the cache and of its namespaces with their
+// sidecars, removing the sidecars left behind by crashes or entries deleted
+// out of band, and the entries of hashed keys left without their sidecar. It holds the global lock so it can run alongside the cache.
+func (f *FileCache) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.LockNamespace)
+		if err != nil {
+			return report, err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		if err := c.reconcile(ctx, f, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (f *FileCache) reconcile(ctx context.Context, parent *FileCache, report *ReconcileReport) error {
+	dirs, err := f.entryDirs(ctx)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimPrefix(strings.TrimPrefix(f.namespace, parent.namespace), "/")
+	for _, dir := range dirs {
+		if err := f.reconcileDir(ctx, dir, prefix, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileCache) reconcileDir(ctx context.Context, dir, prefix string, report *ReconcileReport) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), sidecarFilePrefix) {
+			continue
+		}
+		key := f.nameKey(strings.TrimPrefix(entry.Name(), sidecarFilePrefix))
+
+		if _, err := f.hasFile(ctx, key); errors.Is(err, ErrKeyNotFound) {
+			err := os.Remove(filepath.Join(dir, entry.Name()))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			report.OrphanedSidecars++
+			f.Logger.WithField("key", key).Debug("Removed orphaned sidecar")
+			continue
+		}
+		if _, err := f.readSidecar(key); err != nil {
+			report.CorruptSidecars = append(report.CorruptSidecars, path.Join(prefix, key))
+		}
+	}
+
+	sidecars := map[string]bool{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), sidecarFilePrefix) {
+			sidecars[strings.TrimPrefix(entry.Name(), sidecarFilePrefix)] = true
+		}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isHashedName(entry.Name()) || sidecars[entry.Name()] {
+			continue
+		}
+		// a write commits the entry before its sidecar
+		if info, err := entry.Info(); err != nil || time.Since(info.ModTime()) < orphanGracePeriod {
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		f.index.remove(entry.Name())
+		f.usage.invalidate()
+		report.OrphanedFiles++
+		f.Logger.WithField("file", entry.Name()).Debug("Removed entry orphaned from its sidecar")
+	}
+	return nil
+}
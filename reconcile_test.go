@@ -0,0 +1,73 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	thumbs := fc.Namespace("thumbs")
+	for _, c := range []*FileCache{fc, thumbs} {
+		c.Write(ctx, "key", sampleReader("ABC"))
+		c.SetMeta(ctx, "key", map[string]string{"etag": "1"})
+		c.Write(ctx, "orphan", sampleReader("ABC"))
+		c.SetMeta(ctx, "orphan", map[string]string{"etag": "1"})
+		os.Remove(c.absFilePath("orphan"))
+	}
+	fc.Write(ctx, "corrupt", sampleReader("ABC"))
+	os.WriteFile(fc.sidecarPath("corrupt"), []byte("{"), 0644)
+
+	report, err := fc.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OrphanedSidecars != 2 {
+		t.Fatal("orphaned sidecars must be removed", report)
+	}
+	if len(report.CorruptSidecars) != 1 || report.CorruptSidecars[0] != "corrupt" {
+		t.Fatal("corrupt sidecars must be flagged", report)
+	}
+	if _, err := os.Stat(thumbs.sidecarPath("orphan")); !os.IsNotExist(err) {
+		t.Fatal("orphaned sidecar must be removed")
+	}
+	if meta, _ := fc.GetMeta(ctx, "key"); meta["etag"] != "1" {
+		t.Fatal("paired sidecar must be kept")
+	}
+}
+
+func TestReconcileOrphanedFiles(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxKeyLength: 16}, nil)
+	defer fc.Destroy(ctx)
+
+	long := strings.Repeat("k", 32)
+	fc.Write(ctx, long, sampleReader("ABC"))
+	fc.Write(ctx, long+"2", sampleReader("ABC"))
+	fc.Write(ctx, long+"3", sampleReader("ABC"))
+	old := time.Now().Add(-time.Hour)
+	for _, key := range []string{long, long + "2"} {
+		os.Chtimes(fc.absFilePath(key), old, old)
+	}
+	os.Remove(fc.sidecarPath(long))
+	os.Remove(fc.sidecarPath(long + "3"))
+
+	report, err := fc.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OrphanedFiles != 1 || fc.Has(long) {
+		t.Fatal("hashed entry without sidecar must be removed", report)
+	}
+	if !fc.Has(long+"2") || !fc.Has(long+"3") {
+		t.Fatal("hashed entries with a sidecar or being written must be kept")
+	}
+}
@@ -0,0 +1,93 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// RecoverReport tells what Recover repaired.
+type RecoverReport struct {
+	// TempFiles is the number of temp files of interrupted writes removed.
+	TempFiles int
+	// TruncatedEntries are the keys, prefixed by their namespace path, of
+	// the entries removed because they are shorter than at commit.
+	TruncatedEntries []string
+	// Entries and Bytes are the number and the total size of the entries
+	// of the cache and of its namespaces once recovered.
+	Entries int
+	Bytes   int64
+}
+
+// Recover repairs the cache after a crash or a power loss, and is meant to
+// run at startup, before the cache is used. It removes the temp files of
+// interrupted writes whatever their age, and the entries shorter than the
+// size recorded in their sidecar at commit, as a power loss can leave
+// committed entries without their content. Entries without a recorded size
+// are kept, empty entries included. The in-memory index is then rebuilt
+// and the size recounted. It holds the global lock, but writes of other
+// processes in progress would lose their temp file.
+func (f *FileCache) Recover(ctx context.Context) (RecoverReport, error) {
+	var report RecoverReport
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.LockNamespace)
+		if err != nil {
+			return report, err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	n, err := f.removeTemps(ctx, time.Now())
+	report.TempFiles = n
+	if err != nil {
+		return report, err
+	}
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		if err := c.recover(ctx, f, &report); err != nil {
+			return report, err
+		}
+	}
+	f.trigger.reset()
+	return report, nil
+}
+
+func (f *FileCache) recover(ctx context.Context, parent *FileCache, report *RecoverReport) error {
+	files, err := f.scanFiles(ctx)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimPrefix(strings.TrimPrefix(f.namespace, parent.namespace), "/")
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := f.nameKey(file.Name())
+		if sc, err := f.readSidecar(key); err != nil || file.Size() >= sc.Size {
+			continue
+		}
+		err := f.retry(ctx, func() error { return os.Remove(f.absFilePath(key)) })
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := f.removeSidecar(ctx, key); err != nil {
+			return err
+		}
+		report.TruncatedEntries = append(report.TruncatedEntries, path.Join(prefix, key))
+		f.Logger.WithField("key", key).Warn("Removed truncated entry")
+	}
+
+	if err := f.resync(ctx); err != nil {
+		return err
+	}
+	bytes, entries, err := f.count(ctx)
+	if err != nil {
+		return err
+	}
+	report.Bytes += bytes
+	report.Entries += entries
+	return nil
+}
@@ -0,0 +1,53 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", InMemoryIndex: true}, nil)
+	defer fc.Destroy(ctx)
+	ns := fc.Namespace("ns")
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	fc.Write(ctx, "empty", sampleReader(""))
+	ns.Write(ctx, "truncated", sampleReader("ABC"))
+	ns.Write(ctx, "partial", sampleReader("ABCDEF"))
+	os.Truncate(ns.absFilePath("truncated"), 0)
+	os.Truncate(ns.absFilePath("partial"), 2)
+	tmp, err := os.CreateTemp(fc.TempDir, tempFilePrefix+"*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	report, err := fc.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TempFiles != 1 {
+		t.Fatal("temp files of interrupted writes must be removed", report.TempFiles)
+	}
+	sort.Strings(report.TruncatedEntries)
+	if !reflect.DeepEqual(report.TruncatedEntries, []string{"ns/partial", "ns/truncated"}) {
+		t.Fatal("truncated entries must be removed", report.TruncatedEntries)
+	}
+	if report.Entries != 2 || report.Bytes != 3 {
+		t.Fatal("report must count the recovered entries", report.Entries, report.Bytes)
+	}
+	if !fc.Has("empty") || !fc.Has("key") || ns.Has("truncated") || ns.Has("partial") {
+		t.Fatal("only the truncated entries must be removed")
+	}
+	if _, err := os.Stat(ns.sidecarPath("truncated")); !os.IsNotExist(err) {
+		t.Fatal("sidecar of a truncated entry must be removed", err)
+	}
+	if _, err := os.Stat(tmp.Name()); !os.IsNotExist(err) {
+		t.Fatal("temp file must be removed", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package filecache
+
+import "os"
+
+// renameFile atomically moves oldpath to newpath, replacing newpath if it
+// exists.
+func renameFile(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
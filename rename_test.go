@@ -0,0 +1,25 @@
+package filecache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameFileReplaces(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	os.WriteFile(src, []byte("new"), 0644)
+	os.WriteFile(dst, []byte("old"), 0644)
+
+	if err := renameFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Fatal("destination must be replaced", string(data))
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatal("source must be moved")
+	}
+}
@@ -0,0 +1,39 @@
+package filecache
+
+import "context"
+
+// Resync realigns the state the cache keeps about its directories with the
+// filesystem, after changes made out of band such as a restore from backup
+// or a manual removal. The directories of the cache and of its namespaces
+// are recreated if they were removed, the in-memory index is reloaded, the
+// size is recounted on next use and the count of bytes written since the
+// last GC is dropped. It holds the global lock so it can run alongside
+// the cache.
+func (f *FileCache) Resync(ctx context.Context) error {
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.LockNamespace)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.resync(ctx); err != nil {
+			return err
+		}
+	}
+	f.trigger.reset()
+	return nil
+}
+
+func (f *FileCache) resync(ctx context.Context) error {
+	if _, err := ensureDir(f.BaseDir); err != nil {
+		return err
+	}
+	f.usage.invalidate()
+	return f.loadIndex(ctx)
+}
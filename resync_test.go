@@ -0,0 +1,28 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestResync(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	ns := fc.Namespace("ns")
+
+	if err := os.RemoveAll(fc.BaseDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Resync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal("cache must be writable after a resync", err)
+	}
+	if err := ns.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal("namespace must be writable after a resync", err)
+	}
+}
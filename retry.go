@@ -0,0 +1,38 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+func isTransient(err error) bool {
+	for _, target := range transientErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn until it succeeds, fails with a non transient error or
+// RetryAttempts is exhausted. The backoff between attempts is cut short
+// when ctx is done, the error of the last attempt is then returned.
+func (f *FileCache) retry(ctx context.Context, fn func() error) error {
+	backoff := f.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= f.RetryAttempts || !isTransient(err) {
+			return err
+		}
+		f.Logger.WithError(err).Debugf("Retrying transient error, attempt %d", attempt)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
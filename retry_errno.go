@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package filecache
+
+import "syscall"
+
+// transientErrors are the errno values which are worth a retry, mostly
+// returned by networked filesystems such as NFS.
+var transientErrors = []error{
+	syscall.ESTALE,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+}
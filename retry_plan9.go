@@ -0,0 +1,4 @@
+package filecache
+
+// transientErrors is empty on plan9, which has no errno values.
+var transientErrors []error
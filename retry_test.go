@@ -0,0 +1,58 @@
+//go:build !plan9
+
+package filecache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", RetryAttempts: 3, RetryBackoff: time.Millisecond}, nil)
+	defer fc.Empty(ctx)
+
+	calls := 0
+	err := fc.retry(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return &os.PathError{Op: "rename", Path: "key", Err: syscall.ESTALE}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatal("transient errors must be retried", calls, err)
+	}
+
+	calls = 0
+	err = fc.retry(ctx, func() error {
+		calls++
+		return &os.PathError{Op: "stat", Path: "key", Err: syscall.ENOENT}
+	})
+	if !os.IsNotExist(err) || calls != 1 {
+		t.Fatal("non transient errors must not be retried", calls, err)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", RetryAttempts: 3, RetryBackoff: time.Hour}, nil)
+	defer fc.Destroy(ctx)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	calls := 0
+	err := fc.retry(cctx, func() error {
+		calls++
+		return &os.PathError{Op: "rename", Path: "key", Err: syscall.ESTALE}
+	})
+	if !errors.Is(err, syscall.ESTALE) || calls != 1 {
+		t.Fatal("backoff must stop when the context is done", calls, err)
+	}
+}
@@ -0,0 +1,63 @@
+package filecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// shardDirName is the directory of BaseDir holding the shards of a
+	// cache with a Fanout.
+	shardDirName = internalFilePrefix + "shards"
+	maxFanout    = 3
+)
+
+// entryDir returns the directory of the file of name: BaseDir, or the
+// shard picked by the leading bytes of the hash of name.
+func (f *FileCache) entryDir(name string) string {
+	if f.Fanout <= 0 {
+		return f.BaseDir
+	}
+	sum := sha256.Sum256([]byte(name))
+	parts := []string{f.BaseDir, shardDirName}
+	for i := 0; i < f.Fanout; i++ {
+		parts = append(parts, hex.EncodeToString(sum[i:i+1]))
+	}
+	return filepath.Join(parts...)
+}
+
+// entryDirs returns the directories holding the entries of the cache,
+// either BaseDir or every shard created so far.
+func (f *FileCache) entryDirs(ctx context.Context) ([]string, error) {
+	if f.Fanout <= 0 {
+		return []string{f.BaseDir}, nil
+	}
+	dirs := []string{filepath.Join(f.BaseDir, shardDirName)}
+	for level := 0; level < f.Fanout; level++ {
+		var next []string
+		for _, dir := range dirs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			entries, err := os.ReadDir(dir)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					next = append(next, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+		dirs = next
+	}
+	return dirs, nil
+}
@@ -0,0 +1,72 @@
+package filecache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", Fanout: 2}, nil)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 10; i++ {
+		if err := fc.Write(ctx, fmt.Sprintf("key%d", i), sampleReader("ABC")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel, _ := filepath.Rel(fc.BaseDir, fc.absFilePath("key0"))
+	if filepath.Dir(rel) == "." {
+		t.Fatal("entries must be stored in shards", rel)
+	}
+
+	r, err := fc.Read(ctx, "key0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "ABC" {
+		t.Fatal("content not match", string(data))
+	}
+
+	if keys, _ := fc.Keys(); len(keys) != 10 {
+		t.Fatal("keys must be listed across shards", keys)
+	}
+	fc.WalkConcurrency = 4
+	if size, _ := fc.Size(); size != 30 {
+		t.Fatal("size must be summed across shards", size)
+	}
+	fc.WalkConcurrency = 0
+
+	os.Chtimes(fc.absFilePath("key1"), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	fc.MaxTTL = time.Minute
+	if evicted, _, err := fc.cleanCachedFileByTTL(ctx); err != nil || evicted != 1 {
+		t.Fatal("expired entries must be evicted from shards", evicted, err)
+	}
+	if fc.Has("key1") {
+		t.Fatal("key1 must be evicted")
+	}
+
+	if err := fc.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := fc.Keys(); len(keys) != 0 {
+		t.Fatal("flush must empty every shard", keys)
+	}
+}
+
+func TestFanoutInvalid(t *testing.T) {
+	if _, err := New(Config{TempDir: "tmp", Fanout: maxFanout + 1}, nil); err == nil {
+		t.Fatal("fanout above the max must be rejected")
+	}
+	if _, err := New(Config{TempDir: "tmp", Fanout: -1}, nil); err == nil {
+		t.Fatal("negative fanout must be rejected")
+	}
+}
@@ -0,0 +1,213 @@
+package filecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sidecar holds the metadata of an entry, it is stored as JSON next to the
+// entry and shares its lifecycle.
+type sidecar struct {
+	// Key is the original key of an entry whose file name is a hash of it,
+	// see Config.MaxKeyLength.
+	Key  string            `json:"key,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
+	// Checksum is the hex encoded checksum of the content, computed by the
+	// hash named by ChecksumAlgorithm.
+	Checksum          string `json:"checksum,omitempty"`
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	// Pinned keeps the entry from being evicted, see Pin.
+	Pinned bool `json:"pinned,omitempty"`
+	// ExpiresAt is the expiry time in Unix nanoseconds of an entry written
+	// with its own TTL, see WriteOptions.TTL.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// WrittenAt is the commit time in Unix nanoseconds, recorded when
+	// Config.MaxServeAge is set.
+	WrittenAt int64 `json:"written_at,omitempty"`
+	// AccessedAt is the last access time in Unix nanoseconds, recorded
+	// when Config.PersistAccessTime is set.
+	AccessedAt int64 `json:"accessed_at,omitempty"`
+	// Hits is the number of accesses, recorded when
+	// Config.PersistAccessCount is set.
+	Hits int64 `json:"hits,omitempty"`
+	// Size is the size of the content at commit, so Recover can tell an
+	// entry truncated by a power loss from an empty one.
+	Size int64 `json:"size,omitempty"`
+}
+
+func (sc sidecar) isZero() bool {
+	return len(sc.Key) == 0 && len(sc.Meta) == 0 && len(sc.Checksum) == 0 &&
+		len(sc.ChecksumAlgorithm) == 0 && !sc.Pinned && sc.ExpiresAt == 0 &&
+		sc.WrittenAt == 0 && sc.AccessedAt == 0 && sc.Hits == 0 && sc.Size == 0
+}
+
+// sidecarNames returns the names of the entries which have a sidecar.
+func (f *FileCache) sidecarNames(ctx context.Context) (map[string]bool, error) {
+	dirs, err := f.entryDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, dir := range dirs {
+		if err := readSidecarNames(ctx, dir, names); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+func readSidecarNames(ctx context.Context, dirname string, names map[string]bool) error {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := dir.Readdirnames(readdirBatchSize)
+		for _, name := range batch {
+			if strings.HasPrefix(name, sidecarFilePrefix) {
+				names[strings.TrimPrefix(name, sidecarFilePrefix)] = true
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (f *FileCache) sidecarPath(key string) string {
+	absFilePath := f.absFilePath(key)
+	return filepath.Join(filepath.Dir(absFilePath), sidecarFilePrefix+filepath.Base(absFilePath))
+}
+
+// readSidecar returns the sidecar of key, an entry without sidecar has an
+// empty one.
+func (f *FileCache) readSidecar(key string) (sidecar, error) {
+	var sc sidecar
+	data, err := os.ReadFile(f.sidecarPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sc, nil
+	}
+	if err != nil {
+		return sc, err
+	}
+	err = json.Unmarshal(data, &sc)
+	return sc, err
+}
+
+// writeSidecar atomically replaces the sidecar of key.
+func (f *FileCache) writeSidecar(ctx context.Context, key string, sc sidecar) error {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	path := f.sidecarPath(key)
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := f.retry(ctx, func() error { return renameFile(tmp.Name(), path) }); err != nil {
+		return err
+	}
+	f.index.setSidecar(f.fileName(key), sc)
+	return nil
+}
+
+// updateSidecar applies fn to the sidecar of key. Updates are serialized
+// within the process, so concurrent updates of different fields are not
+// lost.
+func (f *FileCache) updateSidecar(ctx context.Context, key string, fn func(sc *sidecar)) error {
+	f.sidecarMutex.Lock()
+	defer f.sidecarMutex.Unlock()
+
+	sc, err := f.readSidecar(key)
+	if err != nil {
+		return err
+	}
+	fn(&sc)
+	return f.writeSidecar(ctx, key, sc)
+}
+
+func (f *FileCache) removeSidecar(ctx context.Context, key string) error {
+	err := f.retry(ctx, func() error { return os.Remove(f.sidecarPath(key)) })
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SetMeta replaces the metadata attributes of the entry of key. They are
+// removed along with the entry, and dropped when the entry is overwritten.
+func (f *FileCache) SetMeta(ctx context.Context, key string, meta map[string]string) error {
+	return opError("set meta", key, f.setMeta(ctx, key, meta))
+}
+
+func (f *FileCache) setMeta(ctx context.Context, key string, meta map[string]string) error {
+	if err := f.validateKey(key); err != nil {
+		return err
+	}
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.keylock(key))
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	if _, err := f.hasFile(ctx, key); err != nil {
+		return err
+	}
+	return f.updateSidecar(ctx, key, func(sc *sidecar) { sc.Meta = meta })
+}
+
+// GetMeta returns the metadata attributes of the entry of key, an empty
+// map if none was set.
+func (f *FileCache) GetMeta(ctx context.Context, key string) (map[string]string, error) {
+	meta, err := f.getMeta(ctx, key)
+	return meta, opError("get meta", key, err)
+}
+
+func (f *FileCache) getMeta(ctx context.Context, key string) (map[string]string, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, err
+	}
+	if _, err := f.hasFile(ctx, key); err != nil {
+		return nil, err
+	}
+	sc, err := f.readSidecar(key)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Meta == nil {
+		sc.Meta = map[string]string{}
+	}
+	return sc.Meta, nil
+}
+
+// expiredAt reports whether the entry has its own TTL and is expired at t.
+func (sc sidecar) expiredAt(t time.Time) bool {
+	return sc.ExpiresAt > 0 && t.UnixNano() > sc.ExpiresAt
+}
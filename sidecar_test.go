@@ -0,0 +1,53 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMeta(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	if err := fc.SetMeta(ctx, "key", map[string]string{"etag": "1"}); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("must not set meta of a missing key", err)
+	}
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	if meta, err := fc.GetMeta(ctx, "key"); err != nil || len(meta) != 0 {
+		t.Fatal("meta must be empty", meta, err)
+	}
+	if err := fc.SetMeta(ctx, "key", map[string]string{"etag": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := fc.GetMeta(ctx, "key"); err != nil || meta["etag"] != "1" {
+		t.Fatal("meta not match", meta, err)
+	}
+
+	keys, _ := fc.Keys()
+	if len(keys) != 1 {
+		t.Fatal("sidecars must not be listed", keys)
+	}
+	if size, _ := fc.Size(); size != 3 {
+		t.Fatal("sidecars must not be counted", size)
+	}
+
+	if _, err := fc.WriteIfChanged(ctx, "key", sampleReader("DEF")); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := fc.GetMeta(ctx, "key"); len(meta) != 0 {
+		t.Fatal("meta must be dropped on overwrite", meta)
+	}
+
+	fc.SetMeta(ctx, "key", map[string]string{"etag": "2"})
+	if err := fc.Delete(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	if meta, _ := fc.GetMeta(ctx, "key"); len(meta) != 0 {
+		t.Fatal("meta must be removed with the entry", meta)
+	}
+}
@@ -0,0 +1,79 @@
+package filecache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sizeCounter counts the entries of a cache and their bytes, so Size does
+// not list the directories on every call. It is adjusted by the writes and
+// deletes of the cache and recounted from the directories every
+// Config.SizeScanInterval to catch up with changes made out of band.
+type sizeCounter struct {
+	mutex   sync.Mutex
+	bytes   int64
+	entries int
+	// scannedAt is the time of the last count, zero when the count must
+	// be redone.
+	scannedAt time.Time
+}
+
+// Size returns the total size of the cached files. Files of namespaces
+// are not counted. The size is kept up to date by the writes and deletes
+// of the cache, changes made by other processes are only seen once it is
+// recounted, see Config.SizeScanInterval.
+func (fc *FileCache) Size() (int64, error) {
+	return fc.size(context.Background())
+}
+
+func (fc *FileCache) size(ctx context.Context) (int64, error) {
+	bytes, _, err := fc.count(ctx)
+	return bytes, err
+}
+
+// count returns the bytes and the number of the entries of the cache.
+func (fc *FileCache) count(ctx context.Context) (int64, int, error) {
+	c := fc.usage
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.scannedAt.IsZero() && time.Since(c.scannedAt) < fc.SizeScanInterval {
+		return c.bytes, c.entries, nil
+	}
+	files, err := fc.files(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, file := range files {
+		size += file.Size()
+	}
+	c.bytes, c.entries, c.scannedAt = size, len(files), time.Now()
+	return size, len(files), nil
+}
+
+// add adjusts the count by bytes and entries, it is dropped until the
+// first count.
+func (c *sizeCounter) add(bytes int64, entries int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.scannedAt.IsZero() {
+		c.bytes += bytes
+		c.entries += entries
+	}
+}
+
+// reset sets the count of an emptied cache.
+func (c *sizeCounter) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bytes, c.entries, c.scannedAt = 0, 0, time.Now()
+}
+
+// invalidate makes the next Size count the bytes from the directories.
+func (c *sizeCounter) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.scannedAt = time.Time{}
+}
@@ -0,0 +1,56 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSizeCounter(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "key1", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := fc.Size(); size != 3 {
+		t.Fatal("size not match", size)
+	}
+
+	if err := fc.Write(ctx, "key2", sampleReader("DEFG")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.WriteWithOptions(ctx, "key1", sampleReader("A"), WriteOptions{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Delete(ctx, "key2"); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := fc.Size(); size != 1 {
+		t.Fatal("size must follow writes and deletes", size)
+	}
+
+	if err := os.WriteFile(filepath.Join(fc.BaseDir, "outside"), []byte("HIJKL"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := fc.Size(); size != 1 {
+		t.Fatal("size must not be recounted before the interval", size)
+	}
+	if err := fc.Resync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := fc.Size(); size != 6 {
+		t.Fatal("resync must recount the size", size)
+	}
+
+	fc.SizeScanInterval = -1
+	if err := os.Remove(filepath.Join(fc.BaseDir, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := fc.Size(); size != 1 {
+		t.Fatal("a negative interval must recount on every call", size)
+	}
+}
@@ -0,0 +1,173 @@
+package filecache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the activity of a cache.
+type Stats struct {
+	// WritesInFlight is the number of writes holding a write slot.
+	WritesInFlight int64
+	// WritesQueued is the number of writes waiting for a write slot.
+	WritesQueued int64
+
+	// EvictTTL and EvictTTLBytes are the number of entries evicted for
+	// outliving their TTL since the cache was created, and their bytes.
+	EvictTTL      int64
+	EvictTTLBytes int64
+	// EvictSize and EvictSizeBytes are the number of entries evicted to
+	// keep the cache within MaxSize, by the GC or before writes, and their
+	// bytes.
+	EvictSize      int64
+	EvictSizeBytes int64
+
+	// Hits are the reads served from the cache, Misses the reads of keys
+	// missing from it, including those then served from the fallback cache
+	// or the Loader.
+	Hits   int64
+	Misses int64
+	// Writes are the entries committed, Deletes the entries removed by
+	// Delete.
+	Writes  int64
+	Deletes int64
+
+	// Bytes and Entries are the current size and number of entries,
+	// namespaces included, as of their last count, see Size.
+	Bytes   int64
+	Entries int
+	// LastGC is the end of the last GC run, zero if none ran.
+	LastGC time.Time
+
+	// Prefixes are the reads of the keys of each of Config.StatsPrefixes.
+	Prefixes map[string]PrefixStats
+}
+
+// PrefixStats counts the reads of the keys of a prefix.
+type PrefixStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// HitRate returns the share of reads which hit, zero without reads.
+func (s PrefixStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// activity counts the operations of a cache.
+type activity struct {
+	hits    int64
+	misses  int64
+	writes  int64
+	deletes int64
+	// lastGC is the end of the last GC run, in Unix nanoseconds.
+	lastGC int64
+}
+
+func (a *activity) addRead(hit bool) {
+	if hit {
+		atomic.AddInt64(&a.hits, 1)
+	} else {
+		atomic.AddInt64(&a.misses, 1)
+	}
+}
+
+// prefixReads counts the reads of each of Config.StatsPrefixes, the map is
+// made once so only the counters change.
+type prefixReads map[string]*activity
+
+func newPrefixReads(prefixes []string) prefixReads {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	p := prefixReads{}
+	for _, prefix := range prefixes {
+		p[prefix] = &activity{}
+	}
+	return p
+}
+
+// addRead counts a read of key under its longest prefix, if any.
+func (p prefixReads) addRead(key string, hit bool) {
+	var match string
+	for prefix := range p {
+		if strings.HasPrefix(key, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if a, ok := p[match]; ok {
+		a.addRead(hit)
+	}
+}
+
+func (a *activity) addWrite() {
+	atomic.AddInt64(&a.writes, 1)
+}
+
+func (a *activity) addDelete() {
+	atomic.AddInt64(&a.deletes, 1)
+}
+
+func (a *activity) gcDone(t time.Time) {
+	atomic.StoreInt64(&a.lastGC, t.UnixNano())
+}
+
+// evictions counts the entries evicted by each strategy.
+type evictions struct {
+	ttl       int64
+	ttlBytes  int64
+	size      int64
+	sizeBytes int64
+}
+
+func (e *evictions) addTTL(count int, bytes int64) {
+	atomic.AddInt64(&e.ttl, int64(count))
+	atomic.AddInt64(&e.ttlBytes, bytes)
+}
+
+func (e *evictions) addLRU(count int, bytes int64) {
+	atomic.AddInt64(&e.size, int64(count))
+	atomic.AddInt64(&e.sizeBytes, bytes)
+}
+
+// Stats returns a snapshot of the activity of the cache. The counters are
+// shared by the root cache and its namespaces. Bytes and Entries are those
+// of the cache and of its namespaces, a failure to count them is logged.
+func (f *FileCache) Stats() Stats {
+	stats := Stats{
+		WritesInFlight: atomic.LoadInt64(&f.admission.inFlight),
+		WritesQueued:   atomic.LoadInt64(&f.admission.queued),
+		EvictTTL:       atomic.LoadInt64(&f.root.evictions.ttl),
+		EvictTTLBytes:  atomic.LoadInt64(&f.root.evictions.ttlBytes),
+		EvictSize:      atomic.LoadInt64(&f.root.evictions.size),
+		EvictSizeBytes: atomic.LoadInt64(&f.root.evictions.sizeBytes),
+		Hits:           atomic.LoadInt64(&f.root.activity.hits),
+		Misses:         atomic.LoadInt64(&f.root.activity.misses),
+		Writes:         atomic.LoadInt64(&f.root.activity.writes),
+		Deletes:        atomic.LoadInt64(&f.root.activity.deletes),
+	}
+	for prefix, a := range f.root.prefixReads {
+		if stats.Prefixes == nil {
+			stats.Prefixes = map[string]PrefixStats{}
+		}
+		stats.Prefixes[prefix] = PrefixStats{Hits: atomic.LoadInt64(&a.hits), Misses: atomic.LoadInt64(&a.misses)}
+	}
+	if lastGC := atomic.LoadInt64(&f.root.activity.lastGC); lastGC > 0 {
+		stats.LastGC = time.Unix(0, lastGC)
+	}
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		bytes, entries, err := c.count(context.Background())
+		if err != nil {
+			f.Logger.WithError(err).Warn("Failed to count cache entries")
+			break
+		}
+		stats.Bytes += bytes
+		stats.Entries += entries
+	}
+	return stats
+}
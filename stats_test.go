@@ -0,0 +1,140 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxConcurrentWrites: 1}, nil)
+	defer fc.Empty(ctx)
+
+	w, err := fc.Create(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := fc.Stats(); stats.WritesInFlight != 1 {
+		t.Fatal("must have 1 write in flight", stats)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- fc.Write(ctx, "key2", sampleReader("ABC"))
+	}()
+	for i := 0; i < 100 && fc.Stats().WritesQueued == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := fc.Stats(); stats.WritesQueued != 1 {
+		t.Fatal("must have 1 queued write", stats)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := fc.Write(tctx, "key3", sampleReader("ABC")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("queued write must honor its context", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if stats := fc.Stats(); stats.WritesInFlight != 0 || stats.WritesQueued != 0 {
+		t.Fatal("all slots must be released", stats)
+	}
+}
+
+func TestEvictionStats(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)), MaxTTL: time.Minute}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "expired", sampleReader(data))
+	fc.Namespace("ns").Write(ctx, "oldest", sampleReader(data))
+	fc.Namespace("ns").Write(ctx, "newest", sampleReader(data))
+	fc.touch("expired", time.Now().Add(-time.Hour))
+	fc.Namespace("ns").touch("oldest", time.Now().Add(-time.Second))
+
+	result, err := fc.cleanCachedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+	if result.TTLEvicted != 1 || result.TTLBytesFreed != size || result.LRUEvicted != 1 || result.LRUBytesFreed != size || result.BytesFreed != 2*size {
+		t.Fatal("result must break evictions down by strategy", result)
+	}
+	stats := fc.Namespace("ns").Stats()
+	if stats.EvictTTL != 1 || stats.EvictTTLBytes != size || stats.EvictSize != 1 || stats.EvictSizeBytes != size {
+		t.Fatal("stats must count evictions by strategy", stats)
+	}
+}
+
+func TestStatsActivity(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	if stats := fc.Stats(); !stats.LastGC.IsZero() || stats.Entries != 0 {
+		t.Fatal("a new cache must have no activity", stats)
+	}
+	fc.Write(ctx, "key1", sampleReader("ABC"))
+	fc.Set(ctx, "key1", sampleReader("ABCD"))
+	fc.Namespace("ns").Write(ctx, "key2", sampleReader("EF"))
+	fc.Write(ctx, "key3", sampleReader("GHI"))
+	r, err := fc.Read(ctx, "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+	fc.Delete(ctx, "key3")
+	start := time.Now()
+	fc.cleanCachedFiles(ctx)
+
+	stats := fc.Stats()
+	if stats.Writes != 4 || stats.Deletes != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatal("operations must be counted", stats)
+	}
+	if stats.Bytes != 6 || stats.Entries != 2 {
+		t.Fatal("usage must cover the cache and its namespaces", stats)
+	}
+	if stats.LastGC.Before(start) {
+		t.Fatal("the time of the last GC run must be recorded", stats.LastGC)
+	}
+}
+
+func TestStatsPrefixes(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", StatsPrefixes: []string{"images/", "images/thumbs/", "reports/"}}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "images/a", sampleReader("ABC"))
+	for _, key := range []string{"images/a", "images/b", "images/thumbs/a", "reports/a", "other"} {
+		if r, err := fc.Read(ctx, key); err == nil {
+			r.Close()
+		}
+	}
+
+	prefixes := fc.Stats().Prefixes
+	if len(prefixes) != 3 {
+		t.Fatal("every prefix must be reported", prefixes)
+	}
+	if images := prefixes["images/"]; images.Hits != 1 || images.Misses != 1 || images.HitRate() != 0.5 {
+		t.Fatal("reads must be counted under their prefix", images)
+	}
+	if thumbs := prefixes["images/thumbs/"]; thumbs.Misses != 1 {
+		t.Fatal("reads must be counted under their longest prefix", thumbs)
+	}
+	if reports := prefixes["reports/"]; reports.Misses != 1 || reports.HitRate() != 0 {
+		t.Fatal("misses must be counted", reports)
+	}
+}
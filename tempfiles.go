@@ -0,0 +1,91 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultTempFileMaxAge = 24 * time.Hour
+
+// removeStaleTemps removes the temp files left behind by crashed processes,
+// those not modified for TempFileMaxAge. It returns the number of files
+// removed.
+func (f *FileCache) removeStaleTemps(ctx context.Context) (int, error) {
+	if f.TempFileMaxAge < 0 {
+		return 0, nil
+	}
+	return f.removeTemps(ctx, time.Now().Add(-f.TempFileMaxAge))
+}
+
+// removeTemps removes the temp files last modified before before from
+// TempDir and from the base and entry dirs of the cache and of its
+// namespaces. It returns the number of files removed.
+func (f *FileCache) removeTemps(ctx context.Context, before time.Time) (int, error) {
+	dirs := []string{f.TempDir}
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		dirs = append(dirs, c.BaseDir)
+		if c.Fanout <= 0 {
+			continue
+		}
+		entryDirs, err := c.entryDirs(ctx)
+		if err != nil {
+			return 0, err
+		}
+		dirs = append(dirs, entryDirs...)
+	}
+
+	removed := 0
+	for _, dir := range dirs {
+		n, err := removeStaleTempsIn(ctx, dir, before)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	if removed > 0 {
+		f.Logger.Infof("Removed %d temp files", removed)
+	}
+	return removed, nil
+}
+
+// removeStaleTempsIn removes the temp files of dir last modified before
+// before.
+func removeStaleTempsIn(ctx context.Context, dir string, before time.Time) (int, error) {
+	d, err := os.Open(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	removed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		entries, err := d.Readdir(readdirBatchSize)
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), tempFilePrefix) || !entry.ModTime().Before(before) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, err
+			}
+			removed++
+		}
+		if err == io.EOF {
+			return removed, nil
+		}
+		if err != nil {
+			return removed, err
+		}
+	}
+}
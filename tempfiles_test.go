@@ -0,0 +1,51 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStaleTemps(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", Fanout: 1}, nil)
+	defer fc.Destroy(ctx)
+	ns := fc.Namespace("ns")
+
+	fc.Write(ctx, "key", sampleReader("ABC"))
+	shardDir := filepath.Dir(fc.absFilePath("key"))
+	old := time.Now().Add(-2 * defaultTempFileMaxAge)
+	var stale []string
+	for _, dir := range []string{fc.TempDir, shardDir, ns.BaseDir} {
+		tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp.Close()
+		os.Chtimes(tmp.Name(), old, old)
+		stale = append(stale, tmp.Name())
+	}
+	fresh, err := os.CreateTemp(fc.TempDir, tempFilePrefix+"*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh.Close()
+
+	if n, err := fc.removeStaleTemps(ctx); err != nil || n != len(stale) {
+		t.Fatal("stale temp files must be removed", n, err)
+	}
+	for _, name := range stale {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatal("stale temp file must be removed", name)
+		}
+	}
+	if _, err := os.Stat(fresh.Name()); err != nil {
+		t.Fatal("temp file of a write in progress must be kept", err)
+	}
+	if !fc.Has("key") {
+		t.Fatal("entries must be kept")
+	}
+}
@@ -0,0 +1,67 @@
+package filecache
+
+import (
+	"context"
+	"time"
+)
+
+// gcThrottle paces the deletions of a GC run to Config.GCDeletesPerSecond
+// and Config.GCBytesPerSecond. A nil throttle never waits.
+type gcThrottle struct {
+	deletesPerSecond int
+	bytesPerSecond   int64
+	start            time.Time
+	deletes          int
+	bytes            int64
+}
+
+// newGCThrottle returns the throttle of a GC run, nil when no limit is set.
+func (fc *FileCache) newGCThrottle() *gcThrottle {
+	if fc.GCDeletesPerSecond == 0 && fc.GCBytesPerSecond == 0 {
+		return nil
+	}
+	return &gcThrottle{
+		deletesPerSecond: fc.GCDeletesPerSecond,
+		bytesPerSecond:   fc.GCBytesPerSecond,
+		start:            time.Now(),
+	}
+}
+
+// delay returns how long to wait at now before the next deletion so the
+// run stays within its limits.
+func (t *gcThrottle) delay(now time.Time) time.Duration {
+	if t == nil {
+		return 0
+	}
+	var due time.Duration
+	if t.deletesPerSecond > 0 {
+		due = time.Duration(t.deletes) * time.Second / time.Duration(t.deletesPerSecond)
+	}
+	if t.bytesPerSecond > 0 {
+		if d := time.Duration(float64(t.bytes) / float64(t.bytesPerSecond) * float64(time.Second)); d > due {
+			due = d
+		}
+	}
+	return t.start.Add(due).Sub(now)
+}
+
+// deleted accounts for the deletion of an entry of size bytes.
+func (t *gcThrottle) deleted(size int64) {
+	if t == nil {
+		return
+	}
+	t.deletes++
+	t.bytes += size
+}
+
+// wait sleeps for d, or until ctx is done.
+func (t *gcThrottle) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGCThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	for _, config := range []Config{
+		{TempDir: "tmp", MaxTTL: time.Hour, GCDeletesPerSecond: 20},
+		{TempDir: "tmp", MaxTTL: time.Hour, GCBytesPerSecond: 60},
+	} {
+		fc := MustNew(config, nil)
+
+		old := time.Now().Add(-2 * time.Hour)
+		for i := 0; i < 5; i++ {
+			key := "key" + strconv.Itoa(i)
+			fc.Write(ctx, key, sampleReader("ABC"))
+			os.Chtimes(fc.absFilePath(key), old, old)
+		}
+
+		start := time.Now()
+		report, err := fc.CleanNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.TTLEvicted != 5 {
+			t.Fatal("every expired entry must be evicted", report.TTLEvicted)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Fatal("deletions must be paced", config, elapsed)
+		}
+		fc.Destroy(ctx)
+	}
+}
+
+func TestGCThrottleCanceled(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxTTL: time.Hour, GCDeletesPerSecond: 1}, nil)
+	defer fc.Destroy(ctx)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"key1", "key2"} {
+		fc.Write(ctx, key, sampleReader("ABC"))
+		os.Chtimes(fc.absFilePath(key), old, old)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	report, err := fc.CleanNow(cctx)
+	if !errors.Is(err, context.DeadlineExceeded) || report.TTLEvicted != 1 {
+		t.Fatal("a throttled run must stop when its context is done", err, report.TTLEvicted)
+	}
+}
+
+func TestInvalidGCRate(t *testing.T) {
+	if _, err := New(Config{TempDir: "tmp", GCBytesPerSecond: -1}, nil); err == nil {
+		t.Fatal("a negative GC rate must be rejected")
+	}
+}
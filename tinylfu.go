@@ -0,0 +1,108 @@
+package filecache
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	sketchWidth = 4096
+	sketchDepth = 4
+	// sketchMaxCount is where counters saturate, 4 bits worth.
+	sketchMaxCount = 15
+)
+
+// sketch estimates the access frequency of keys with a count-min sketch.
+// Counters are halved every sketchWidth*10 increments, so the estimates
+// follow the recent accesses rather than the whole history.
+type sketch struct {
+	mutex     sync.Mutex
+	seed      maphash.Seed
+	counters  [sketchDepth][sketchWidth]uint8
+	additions int
+}
+
+func newSketch() *sketch {
+	return &sketch{seed: maphash.MakeSeed()}
+}
+
+func (s *sketch) indexes(key string) [sketchDepth]int {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	h.WriteString(key)
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	var idx [sketchDepth]int
+	for i := range idx {
+		idx[i] = int((h1 + uint32(i)*h2) % sketchWidth)
+	}
+	return idx
+}
+
+// add records an access of key.
+func (s *sketch) add(key string) {
+	if s == nil {
+		return
+	}
+	idx := s.indexes(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, j := range idx {
+		if s.counters[i][j] < sketchMaxCount {
+			s.counters[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= sketchWidth*10 {
+		for i := range s.counters {
+			for j := range s.counters[i] {
+				s.counters[i][j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+// estimate returns the estimated number of recent accesses of key.
+func (s *sketch) estimate(key string) uint8 {
+	idx := s.indexes(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	min := uint8(sketchMaxCount)
+	for i, j := range idx {
+		if s.counters[i][j] < min {
+			min = s.counters[i][j]
+		}
+	}
+	return min
+}
+
+// admit decides whether an entry of key and size may enter the cache, see
+// Config.TinyLFU. Entries are admitted while the cache has room or when
+// they replace an entry, and otherwise if key is estimated to be accessed
+// more often than the least recently used entry, the eviction victim.
+// Expired entries make room first, so they admit any entry.
+func (f *FileCache) admit(ctx context.Context, key string, size int64) error {
+	if f.frequency == nil {
+		return nil
+	}
+	maxSize, _ := f.limits()
+	if used, err := f.size(ctx); err != nil || used+size <= maxSize {
+		return err
+	}
+	if _, err := f.hasFile(ctx, key); err == nil {
+		return nil
+	}
+	state, err := f.evictionState(ctx)
+	if err != nil {
+		return err
+	}
+	if len(state.Entries) == 0 || len(state.expired) > 0 {
+		return nil
+	}
+	if f.frequency.estimate(key) <= f.frequency.estimate(state.Entries[0].Key) {
+		return ErrNotAdmitted
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTinyLFU(t *testing.T) {
+	ctx := context.Background()
+	data := "bytesample"
+
+	fc := MustNew(Config{TempDir: "tmp", MaxSize: int64(len(data)) * 2, TinyLFU: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "hot", sampleReader(data))
+	fc.Write(ctx, "cold", sampleReader(data))
+	for i := 0; i < 3; i++ {
+		r, err := fc.Read(ctx, "hot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+
+	if err := fc.Write(ctx, "oneshot", sampleReader(data)); !errors.Is(err, ErrNotAdmitted) {
+		t.Fatal("an entry accessed less than the victim must not be admitted", err)
+	}
+	if !fc.Has("hot") || !fc.Has("cold") || fc.Has("oneshot") {
+		t.Fatal("a rejected entry must leave the cache untouched")
+	}
+	if err := fc.WriteWithOptions(ctx, "cold", sampleReader(data), WriteOptions{Overwrite: true}); err != nil {
+		t.Fatal("entries replacing another one must be admitted", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		fc.Read(ctx, "oneshot")
+	}
+	if err := fc.Write(ctx, "oneshot", sampleReader(data)); err != nil {
+		t.Fatal("an entry accessed more than the victim must be admitted", err)
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch()
+	for i := 0; i < sketchMaxCount+5; i++ {
+		s.add("key")
+	}
+	if got := s.estimate("key"); got != sketchMaxCount {
+		t.Fatal("counters must saturate", got)
+	}
+	if got := s.estimate("other"); got > 1 {
+		t.Fatal("unseen keys must be estimated rare", got)
+	}
+	for i := 0; i < sketchWidth*10; i++ {
+		s.add("filler")
+	}
+	if got := s.estimate("key"); got >= sketchMaxCount {
+		t.Fatal("counters must age", got)
+	}
+}
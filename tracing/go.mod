@@ -0,0 +1,20 @@
+module github.com/mobile-health/filecache/tracing
+
+go 1.18
+
+require (
+	github.com/mobile-health/filecache v0.0.0-20261016030512-48b52925f5d9
+	go.opentelemetry.io/otel v1.11.2
+	go.opentelemetry.io/otel/trace v1.11.2
+)
+
+require (
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/sirupsen/logrus v1.9.0 // indirect
+	golang.org/x/sys v0.0.0-20220919091848-fb04ddd9f9c8 // indirect
+)
+
+// The parent module is used from the working tree when developing in this
+// repository, consumers of this module get the version required above.
+replace github.com/mobile-health/filecache => ../
@@ -0,0 +1,59 @@
+// Package tracing traces the operations of a cache with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/mobile-health/filecache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/mobile-health/filecache"
+
+// Tracer is a filecache.Instrument recording a span per read, write, delete
+// and GC run. Keys are recorded hashed, so they do not leak into traces.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a tracer recording spans with tp, or with the global tracer
+// provider if tp is nil. Add it to a cache with FileCache.Instrument.
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// StartOp implements filecache.Instrument.
+func (t *Tracer) StartOp(ctx context.Context, op filecache.Op) (context.Context, func(filecache.OpResult)) {
+	attrs := []attribute.KeyValue{attribute.String("filecache.namespace", op.Namespace)}
+	if len(op.Key) > 0 {
+		attrs = append(attrs, attribute.String("filecache.key_hash", keyHash(op.Key)))
+	}
+	ctx, span := t.tracer.Start(ctx, "filecache."+op.Name, trace.WithAttributes(attrs...))
+	return ctx, func(result filecache.OpResult) {
+		span.SetAttributes(attribute.Int64("filecache.bytes", result.Bytes))
+		if op.Name == "read" {
+			span.SetAttributes(attribute.Bool("filecache.hit", result.Hit))
+		}
+		// a miss is an expected outcome of a read
+		if result.Err != nil && !errors.Is(result.Err, filecache.ErrKeyNotFound) {
+			span.RecordError(result.Err)
+			span.SetStatus(codes.Error, result.Err.Error())
+		}
+		span.End()
+	}
+}
+
+// keyHash returns the first 16 hex digits of the SHA-256 of key.
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mobile-health/filecache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recorder is a minimal trace.TracerProvider that keeps ended spans, so the
+// tests do not need the otel SDK.
+type recorder struct {
+	ended []*recordedSpan
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer { return r }
+
+func (r *recorder) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordedSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		r:     r,
+		name:  name,
+		attrs: map[attribute.Key]attribute.Value{},
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type recordedSpan struct {
+	trace.Span
+	r      *recorder
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *recordedSpan) End(...trace.SpanEndOption) { s.r.ended = append(s.r.ended, s) }
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+
+	rec := &recorder{}
+	fc := filecache.MustNew(filecache.Config{BaseDir: "filecache", TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	fc.Instrument(New(rec))
+
+	fc.Write(ctx, "key", strings.NewReader("ABC"))
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	fc.Read(ctx, "missing")
+
+	spans := rec.ended
+	if len(spans) != 3 {
+		t.Fatal("a span must be recorded per operation", len(spans))
+	}
+	if spans[0].name != "filecache.write" || spans[0].attrs["filecache.bytes"].AsInt64() != 3 {
+		t.Fatal("write span must record the bytes written", spans[0].name, spans[0].attrs)
+	}
+	if hash := spans[1].attrs["filecache.key_hash"].AsString(); hash != keyHash("key") || strings.Contains(hash, "key") {
+		t.Fatal("keys must be recorded hashed", hash)
+	}
+	if !spans[1].attrs["filecache.hit"].AsBool() || spans[2].attrs["filecache.hit"].AsBool() {
+		t.Fatal("read spans must record whether the read hit")
+	}
+	if spans[2].status == codes.Error {
+		t.Fatal("a miss must not be recorded as an error")
+	}
+}
@@ -0,0 +1,38 @@
+package filecache
+
+import "sync/atomic"
+
+// gcTrigger counts the bytes written since the last GC run, and signals
+// the GC loop when they exceed Config.GCWriteThreshold. Signals sent
+// while one is pending are dropped, so a burst of writes schedules a
+// single run.
+type gcTrigger struct {
+	written int64
+	c       chan struct{}
+}
+
+func newGCTrigger() *gcTrigger {
+	return &gcTrigger{c: make(chan struct{}, 1)}
+}
+
+func (t *gcTrigger) add(n, threshold int64) {
+	if threshold <= 0 {
+		return
+	}
+	if atomic.AddInt64(&t.written, n) >= threshold {
+		select {
+		case t.c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// reset starts a new count, dropping a pending signal which the starting
+// run makes moot.
+func (t *gcTrigger) reset() {
+	atomic.StoreInt64(&t.written, 0)
+	select {
+	case <-t.c:
+	default:
+	}
+}
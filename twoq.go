@@ -0,0 +1,109 @@
+package filecache
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	defaultTwoQIn     = 0.25
+	defaultTwoQGhosts = 1024
+)
+
+// TwoQ is a scan-resistant eviction policy after the 2Q algorithm. Entries
+// accessed at most once are on probation and evicted first, oldest first,
+// as long as they take more than In of MaxSize; entries accessed again are
+// protected and only evicted, least recently used first, once probation is
+// within its share. A bulk read of entries accessed once thus only cycles
+// through the probation share instead of flushing the hot entries.
+//
+// Accesses are counted with Config.PersistAccessCount. Keys evicted from
+// probation are also remembered, up to Ghosts of them, and protected if
+// they are written again. Expired entries are evicted first. A TwoQ must
+// not be shared by several caches.
+type TwoQ struct {
+	// In is the share of MaxSize for entries on probation, it defaults
+	// to 0.25.
+	In float64
+	// Ghosts is the number of keys remembered after their eviction from
+	// probation, it defaults to 1024.
+	Ghosts int
+
+	mutex  sync.Mutex
+	ghosts map[string]bool
+	order  []string
+}
+
+func (q *TwoQ) Candidates(ctx context.Context, state EvictionState) []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var keys []string
+	var probation, protected []EntryInfo
+	var probationSize int64
+	size, count := state.Size, state.Count
+	for _, entry := range state.Entries {
+		switch {
+		case state.Expired(entry):
+			keys = append(keys, entry.Key)
+			size, count = size-entry.Size, count-1
+		case state.Hits(entry) > 1 || q.ghosts[entry.Key]:
+			protected = append(protected, entry)
+		default:
+			probation = append(probation, entry)
+			probationSize += entry.Size
+		}
+	}
+
+	in := q.In
+	if in <= 0 {
+		in = defaultTwoQIn
+	}
+	for !state.fits(size, count) && len(probation)+len(protected) > 0 {
+		var entry EntryInfo
+		if len(protected) == 0 || len(probation) > 0 && float64(probationSize) > in*float64(state.MaxSize) {
+			entry, probation = probation[0], probation[1:]
+			probationSize -= entry.Size
+			q.remember(entry.Key)
+		} else {
+			entry, protected = protected[0], protected[1:]
+			q.forget(entry.Key)
+		}
+		keys = append(keys, entry.Key)
+		size, count = size-entry.Size, count-1
+	}
+	return keys
+}
+
+// remember adds key to the ghosts, dropping the oldest one if full.
+func (q *TwoQ) remember(key string) {
+	if q.ghosts == nil {
+		q.ghosts = map[string]bool{}
+	}
+	if q.ghosts[key] {
+		return
+	}
+	max := q.Ghosts
+	if max <= 0 {
+		max = defaultTwoQGhosts
+	}
+	if len(q.order) >= max {
+		delete(q.ghosts, q.order[0])
+		q.order = q.order[1:]
+	}
+	q.ghosts[key] = true
+	q.order = append(q.order, key)
+}
+
+func (q *TwoQ) forget(key string) {
+	if !q.ghosts[key] {
+		return
+	}
+	delete(q.ghosts, key)
+	for i, k := range q.order {
+		if k == key {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package filecache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTwoQ(t *testing.T) {
+	ctx := context.Background()
+	q := &TwoQ{}
+
+	// hot was read repeatedly, then a scan wrote and read scan1..scan3 once
+	state := EvictionState{
+		Entries: []EntryInfo{{Key: "hot", Size: 2}, {Key: "scan1", Size: 2}, {Key: "scan2", Size: 2}, {Key: "scan3", Size: 2}},
+		Size:    8,
+		MaxSize: 4,
+		hits:    map[string]int64{"hot": 5, "scan1": 1, "scan2": 1, "scan3": 1},
+	}
+	keys := q.Candidates(ctx, state)
+	if len(keys) != 2 || keys[0] != "scan1" || keys[1] != "scan2" {
+		t.Fatal("entries on probation must be evicted before the hot ones", keys)
+	}
+
+	// scan1 is written again: evicted from probation, it is now protected
+	state = EvictionState{
+		Entries: []EntryInfo{{Key: "hot", Size: 2}, {Key: "scan3", Size: 2}, {Key: "scan1", Size: 2}, {Key: "new", Size: 2}},
+		Size:    8,
+		MaxSize: 4,
+		hits:    map[string]int64{"hot": 5},
+	}
+	keys = q.Candidates(ctx, state)
+	if len(keys) != 2 || keys[0] != "scan3" || keys[1] != "new" {
+		t.Fatal("keys coming back after their eviction must be protected", keys)
+	}
+
+	// once probation is within its share, protected entries are evicted
+	state = EvictionState{
+		Entries: []EntryInfo{{Key: "hot", Size: 2}, {Key: "scan1", Size: 2}, {Key: "new", Size: 1}},
+		Size:    5,
+		MaxSize: 4,
+		hits:    map[string]int64{"hot": 5},
+	}
+	keys = q.Candidates(ctx, state)
+	if len(keys) != 1 || keys[0] != "hot" {
+		t.Fatal("protected entries must be evicted least recently used first", keys)
+	}
+}
@@ -0,0 +1,127 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// UpdateFunc returns the new content of an entry from its current one. It
+// must not write to the cache, such writes deadlock with a pending Flush.
+type UpdateFunc func(old io.Reader) (io.Reader, error)
+
+// Update replaces the entry of key with the content fn returns from the
+// current one, an empty reader if key is missing. Updates of a key do not
+// interleave, an error of fn is returned as is.
+func (f *FileCache) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	return opError("update", key, f.update(ctx, key, fn))
+}
+
+func (f *FileCache) update(ctx context.Context, key string, fn UpdateFunc) error {
+	if err := f.validateKey(key); err != nil {
+		return err
+	}
+	// the key lock is released while EvictBeforeWrite makes room, this one
+	// is held until the commit
+	unlock, err := f.root.updates.lock(ctx, f.keylock(key))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	w, err := f.create(ctx, key, WriteOptions{Overwrite: true})
+	if err != nil {
+		return err
+	}
+	old, err := f.openCurrent(key)
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	defer old.Close()
+
+	r, err := fn(old)
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return err
+	}
+	// the entry may not be replaced while it is open on Windows
+	old.Close()
+	return w.Close()
+}
+
+// openCurrent opens the content of key for an update, an entry which may
+// not be served any more is handled as missing.
+func (f *FileCache) openCurrent(key string) (io.ReadCloser, error) {
+	file, err := os.Open(f.absFilePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if (f.LazyExpire && f.expired(key, info.ModTime())) || f.servedTooLate(key, info.ModTime()) {
+		file.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return file, nil
+}
+
+// keyLocks are in-process locks by key lock, serializing the updates of a
+// key whether or not a lock factory is configured.
+type keyLocks struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	held chan struct{}
+	refs int
+}
+
+// lock waits for the lock of key, or for ctx to be done, and returns the
+// function releasing it.
+func (l *keyLocks) lock(ctx context.Context, key string) (func(), error) {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*keyLock{}
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{held: make(chan struct{}, 1)}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mutex.Unlock()
+
+	forget := func() {
+		l.mutex.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mutex.Unlock()
+	}
+	select {
+	case kl.held <- struct{}{}:
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-kl.held
+		forget()
+	}, nil
+}
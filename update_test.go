@@ -0,0 +1,92 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func increment(old io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(old)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	if len(data) > 0 {
+		if n, err = strconv.Atoi(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return strings.NewReader(strconv.Itoa(n + 1)), nil
+}
+
+func TestUpdate(t *testing.T) {
+	lockFactory := &LockFactory{locks: map[string]bool{}, mutex: &sync.Mutex{}}
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, lockFactory)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 3; i++ {
+		if err := fc.Update(ctx, "counter", increment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := fc.Read(ctx, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "3" {
+		t.Fatal("counter must be incremented from nothing", string(data))
+	}
+
+	errFailed := errors.New("failed")
+	err = fc.Update(ctx, "counter", func(old io.Reader) (io.Reader, error) { return nil, errFailed })
+	if !errors.Is(err, errFailed) {
+		t.Fatal("error of fn must be returned", err)
+	}
+	if err := fc.Update(ctx, "counter", increment); err != nil {
+		t.Fatal("key must be unlocked after a failed update", err)
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	for _, config := range []Config{
+		{TempDir: "tmp"},
+		{TempDir: "tmp", EvictBeforeWrite: true},
+	} {
+		fc := MustNew(config, nil)
+
+		const n = 50
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := fc.Update(ctx, "counter", increment); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		r, err := fc.Read(ctx, "counter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != strconv.Itoa(n) {
+			t.Fatal("concurrent updates must not be lost", string(data))
+		}
+		fc.Destroy(ctx)
+	}
+}
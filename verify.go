@@ -0,0 +1,127 @@
+package filecache
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// quarantineDirName is the default directory of BaseDir holding the
+// entries quarantined by Verify.
+const quarantineDirName = internalFilePrefix + "quarantine"
+
+// VerifyReport tells what Verify found.
+type VerifyReport struct {
+	// Checked is the number of entries read back.
+	Checked int
+	// Checksummed is the number of entries compared with their recorded
+	// checksum, see Config.ChecksumWrites.
+	Checksummed int
+	// Corrupt are the keys, prefixed by their namespace path, of the
+	// entries moved to Config.QuarantineDir.
+	Corrupt []string
+}
+
+// Verify reads back every entry of the cache and of its namespaces and
+// moves those which can not be read, or whose size or content no longer
+// matches the one recorded at commit, to Config.QuarantineDir, keeping
+// their file name under their namespace path. Checksums are recorded for
+// every entry with Config.ChecksumWrites, and by WriteIfChanged; the other
+// entries are only checked to be readable and of their committed size.
+// Each entry is verified holding its lock, so it can run alongside the
+// cache.
+func (f *FileCache) Verify(ctx context.Context) (VerifyReport, error) {
+	var report VerifyReport
+	for _, c := range append([]*FileCache{f}, f.Namespaces()...) {
+		if err := c.verify(ctx, f, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (f *FileCache) verify(ctx context.Context, parent *FileCache, report *VerifyReport) error {
+	files, err := f.scanFiles(ctx)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimPrefix(strings.TrimPrefix(f.namespace, parent.namespace), "/")
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := f.nameKey(file.Name())
+		corrupt, err := f.verifyEntry(ctx, key, report)
+		if err != nil {
+			return err
+		}
+		if corrupt {
+			report.Corrupt = append(report.Corrupt, path.Join(prefix, key))
+			f.Logger.WithField("key", key).Warn("Quarantined corrupted entry")
+		}
+	}
+	return nil
+}
+
+// verifyEntry reads back the entry of key and quarantines it if it is
+// corrupted. An entry removed meanwhile is skipped.
+func (f *FileCache) verifyEntry(ctx context.Context, key string, report *VerifyReport) (bool, error) {
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.keylock(key))
+		if err != nil {
+			return false, err
+		}
+		defer lock.Unlock(ctx)
+	}
+
+	absFilePath := f.absFilePath(key)
+	file, err := os.Open(absFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	report.Checked++
+	corrupt := err != nil
+	if err == nil {
+		h := f.newHash()
+		n, err := io.Copy(h, file)
+		file.Close()
+		corrupt = err != nil
+		if sc, scErr := f.readSidecar(key); !corrupt && scErr == nil {
+			corrupt = sc.Size > 0 && n != sc.Size
+			if sc.ChecksumAlgorithm == f.hashAlgorithm() && len(sc.Checksum) > 0 {
+				report.Checksummed++
+				corrupt = corrupt || hex.EncodeToString(h.Sum(nil)) != sc.Checksum
+			}
+		}
+	}
+	if !corrupt {
+		return false, nil
+	}
+	return true, f.quarantine(ctx, absFilePath, key)
+}
+
+// quarantine moves the corrupted entry of key at absFilePath to
+// QuarantineDir and drops its sidecar.
+func (f *FileCache) quarantine(ctx context.Context, absFilePath, key string) error {
+	info, err := os.Stat(absFilePath)
+	if err != nil {
+		return err
+	}
+	dir, err := ensureDir(filepath.Join(f.QuarantineDir, filepath.FromSlash(f.namespace)))
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(dir, filepath.Base(absFilePath))
+	if err := f.retry(ctx, func() error { return os.Rename(absFilePath, dest) }); err != nil {
+		return err
+	}
+	f.usage.add(-info.Size(), -1)
+	f.index.remove(f.fileName(key))
+	return f.removeSidecar(ctx, key)
+}
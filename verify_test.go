@@ -0,0 +1,85 @@
+package filecache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	ns := fc.Namespace("ns")
+
+	fc.WriteIfChanged(ctx, "good", sampleReader("ABC"))
+	fc.Write(ctx, "plain", sampleReader("ABC"))
+	ns.WriteIfChanged(ctx, "bad", sampleReader("ABC"))
+	if err := os.WriteFile(ns.absFilePath("bad"), []byte("XYZ"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := fc.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || report.Checksummed != 2 {
+		t.Fatal("every entry must be checked", report.Checked, report.Checksummed)
+	}
+	if !reflect.DeepEqual(report.Corrupt, []string{"ns/bad"}) {
+		t.Fatal("corrupted entry must be reported", report.Corrupt)
+	}
+	if ns.Has("bad") || !fc.Has("good") || !fc.Has("plain") {
+		t.Fatal("only the corrupted entry must be removed")
+	}
+	data, err := os.ReadFile(filepath.Join(fc.QuarantineDir, "ns", "bad"))
+	if err != nil || string(data) != "XYZ" {
+		t.Fatal("corrupted entry must be quarantined", string(data), err)
+	}
+	if keys, _ := fc.Keys(); len(keys) != 2 {
+		t.Fatal("quarantine must not be listed", keys)
+	}
+}
+
+func TestVerifyChecksumWrites(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", ChecksumWrites: true}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "good", sampleReader("ABC"))
+	fc.Write(ctx, "flipped", sampleReader("ABC"))
+	os.WriteFile(fc.absFilePath("flipped"), []byte("ABD"), 0666)
+
+	report, err := fc.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 2 || report.Checksummed != 2 {
+		t.Fatal("entries written by Write must be checksummed", report.Checked, report.Checksummed)
+	}
+	if !reflect.DeepEqual(report.Corrupt, []string{"flipped"}) || fc.Has("flipped") || !fc.Has("good") {
+		t.Fatal("corrupted entry written by Write must be quarantined", report.Corrupt)
+	}
+}
+
+func TestVerifySize(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "truncated", sampleReader("ABC"))
+	os.Truncate(fc.absFilePath("truncated"), 1)
+
+	report, err := fc.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checksummed != 0 || !reflect.DeepEqual(report.Corrupt, []string{"truncated"}) {
+		t.Fatal("entry of another size than committed must be quarantined", report.Checksummed, report.Corrupt)
+	}
+}
@@ -0,0 +1,138 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WalkFunc is called by Walk for each entry with a reader of its content.
+// The reader is closed when the function returns, it does not need to be
+// read to the end.
+type WalkFunc func(key string, r io.Reader, info EntryInfo) error
+
+// Walk calls fn for each entry of the cache, oldest first. Entries are
+// opened like with Peek, so walking does not update their access time.
+// Entries deleted during the walk are skipped. Walk stops at the first
+// error returned by fn or when ctx is done, and returns that error.
+// Entries of namespaces are not walked.
+func (f *FileCache) Walk(ctx context.Context, fn WalkFunc) error {
+	files, err := f.files(ctx)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f.walkEntry(ctx, f.nameKey(file.Name()), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileCache) walkEntry(ctx context.Context, key string, fn WalkFunc) error {
+	r, err := f.read(ctx, key, false)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return opError("walk", key, err)
+	}
+	file := r.(*os.File)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return opError("walk", key, err)
+	}
+	info := f.newEntryInfo(stat)
+	return fn(info.Key, file, info)
+}
+
+// filesConcurrently is like files but stats the entries with a pool of
+// WalkConcurrency workers. The directories are read by name, which needs
+// no stat, and the names are handed to the workers in batches.
+func (fc *FileCache) filesConcurrently(ctx context.Context) ([]fs.FileInfo, error) {
+	dirs, err := fc.entryDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(chan string, readdirBatchSize)
+	var (
+		mutex   sync.Mutex
+		list    []fs.FileInfo
+		statErr error
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < fc.WalkConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				info, err := os.Lstat(path)
+				mutex.Lock()
+				switch {
+				case errors.Is(err, fs.ErrNotExist):
+					// deleted since the directory was read
+				case err != nil:
+					if statErr == nil {
+						statErr = err
+					}
+				case !info.IsDir():
+					list = append(list, info)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, dir := range dirs {
+		if err = fc.readNames(ctx, dir, paths); err != nil {
+			break
+		}
+	}
+	close(paths)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if statErr != nil {
+		return nil, statErr
+	}
+	sortFiles(list)
+	return list, nil
+}
+
+// readNames sends the paths of the entries of dirname to paths.
+func (fc *FileCache) readNames(ctx context.Context, dirname string, paths chan<- string) error {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := dir.Readdirnames(readdirBatchSize)
+		for _, name := range batch {
+			if !isInternalFile(name) {
+				paths <- filepath.Join(dirname, name)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+
+	fc.Write(ctx, "key1", sampleReader("ABC"))
+	fc.Write(ctx, "key2", sampleReader("DEFG"))
+	fc.touch("key1", time.Now().Add(-time.Minute))
+	fc.touch("key2", time.Now())
+
+	var keys []string
+	err := fc.Walk(ctx, func(key string, r io.Reader, info EntryInfo) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != info.Size || key != info.Key {
+			t.Fatal("info not match", key, info)
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "key1" || keys[1] != "key2" {
+		t.Fatal("entries must be walked oldest first", keys)
+	}
+	if oldest, _, _ := fc.Oldest(ctx); oldest != "key1" {
+		t.Fatal("walk must not update access times", oldest)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = fc.Walk(ctx, func(key string, r io.Reader, info EntryInfo) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Fatal("walk must stop at the first error", calls, err)
+	}
+}
+
+func TestWalkConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", WalkConcurrency: 4}, nil)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		fc.Write(ctx, key, sampleReader("ABC"))
+		fc.touch(key, time.Now().Add(time.Duration(i-100)*time.Second))
+	}
+	fc.Namespace("ns").Write(ctx, "key", sampleReader("ABC"))
+
+	files, err := fc.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 100 {
+		t.Fatal("must list every entry", len(files))
+	}
+	for i, file := range files {
+		if file.Name() != fmt.Sprintf("key%d", i) {
+			t.Fatal("entries must be sorted by mod time", i, file.Name())
+		}
+	}
+	if size, _ := fc.Size(); size != 300 {
+		t.Fatal("size not match", size)
+	}
+}
+
+func BenchmarkFiles(b *testing.B) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", Silent: true}, nil)
+	defer fc.Destroy(ctx)
+	for i := 0; i < 5000; i++ {
+		fc.Write(ctx, fmt.Sprintf("key%d", i), sampleReader("ABC"))
+	}
+
+	for _, concurrency := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("WalkConcurrency=%d", concurrency), func(b *testing.B) {
+			fc.WalkConcurrency = concurrency
+			for i := 0; i < b.N; i++ {
+				if _, err := fc.Files(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package filecache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errDiskSpaceUnsupported is returned by statDiskSpace on the platforms
+// where the space of a filesystem can not be queried. Watermarks given as a
+// percentage and MinFreeSpace are then disabled.
+var errDiskSpaceUnsupported = errors.New("disk space is not supported on this platform")
+
+// diskSpace is statDiskSpace, it is replaced in tests.
+var diskSpace = statDiskSpace
+
+// Watermark is a cache size given either in bytes or as a percentage of
+// the filesystem of BaseDir. Percent takes precedence when both are set.
+type Watermark struct {
+	Bytes   int64
+	Percent float64
+}
+
+func (w Watermark) isZero() bool {
+	return w.Bytes == 0 && w.Percent == 0
+}
+
+// resolve returns the watermark in bytes for a filesystem of total bytes.
+func (w Watermark) resolve(total int64) int64 {
+	if w.Percent > 0 {
+		return int64(w.Percent / 100 * float64(total))
+	}
+	return w.Bytes
+}
+
+func (w Watermark) validate() error {
+	if w.Bytes < 0 || w.Percent < 0 || w.Percent > 100 {
+		return fmt.Errorf("invalid watermark %+v", w)
+	}
+	return nil
+}
+
+// validateWatermarks checks the watermarks of config, the low one must not
+// be over the high one.
+func validateWatermarks(high, low Watermark) error {
+	if err := high.validate(); err != nil {
+		return err
+	}
+	if err := low.validate(); err != nil {
+		return err
+	}
+	if high.isZero() && !low.isZero() {
+		return fmt.Errorf("low watermark %+v without a high watermark", low)
+	}
+	if (high.Percent > 0) == (low.Percent > 0) && low.resolve(100) > high.resolve(100) {
+		return fmt.Errorf("low watermark %+v is over high watermark %+v", low, high)
+	}
+	return nil
+}
+
+// watermarkTarget returns the size the GC evicts a cache of size bytes
+// down to when Config.HighWatermark is set: the low watermark once size
+// is over the high one, and the high one otherwise, so nothing is evicted
+// until the high one is crossed.
+func (fc *FileCache) watermarkTarget(size int64) (int64, bool, error) {
+	if fc.HighWatermark.isZero() {
+		return 0, false, nil
+	}
+	var total int64
+	if fc.HighWatermark.Percent > 0 || fc.LowWatermark.Percent > 0 {
+		var err error
+		if total, _, err = diskSpace(fc.BaseDir); errors.Is(err, errDiskSpaceUnsupported) {
+			return 0, false, nil
+		} else if err != nil {
+			return 0, false, err
+		}
+	}
+	high := fc.HighWatermark.resolve(total)
+	low := high
+	if !fc.LowWatermark.isZero() {
+		low = fc.LowWatermark.resolve(total)
+	}
+	if size > high {
+		return low, true, nil
+	}
+	return high, true, nil
+}
+
+// freeSpaceDeficit returns how many bytes are missing on the filesystem of
+// BaseDir to keep Config.MinFreeSpace free, zero if there are enough.
+func (fc *FileCache) freeSpaceDeficit() (int64, error) {
+	if fc.MinFreeSpace.isZero() {
+		return 0, nil
+	}
+	total, free, err := diskSpace(fc.BaseDir)
+	if errors.Is(err, errDiskSpaceUnsupported) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if deficit := fc.MinFreeSpace.resolve(total) - free; deficit > 0 {
+		return deficit, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,111 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatermarks(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", HighWatermark: Watermark{Bytes: 40}, LowWatermark: Watermark{Bytes: 20}}, nil)
+	defer fc.Destroy(ctx)
+
+	write := func(i int) {
+		key := fmt.Sprintf("key%d", i)
+		if err := fc.Write(ctx, key, sampleReader("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		ts := time.Now().Add(time.Duration(i) * time.Second)
+		os.Chtimes(fc.absFilePath(key), ts, ts)
+	}
+	for i := 0; i < 4; i++ {
+		write(i)
+	}
+	if result, _ := fc.cleanCachedFiles(ctx); result.LRUEvicted != 0 {
+		t.Fatal("nothing must be evicted below the high watermark", result)
+	}
+
+	write(4)
+	if result, _ := fc.cleanCachedFiles(ctx); result.LRUEvicted != 3 {
+		t.Fatal("the cache must be evicted down to the low watermark", result)
+	}
+	if size, _ := fc.Size(); size != 20 {
+		t.Fatal("size not match", size)
+	}
+}
+
+func TestWatermarkPercent(t *testing.T) {
+	fc := MustNew(Config{TempDir: "tmp", HighWatermark: Watermark{Percent: 50}}, nil)
+	defer fc.Destroy(context.Background())
+
+	total, free, err := diskSpace(fc.BaseDir)
+	if err != nil || total <= 0 || free < 0 || free > total {
+		t.Fatal("disk space must be reported", total, free, err)
+	}
+	if target, ok, err := fc.watermarkTarget(0); err != nil || !ok || target != total/2 {
+		t.Fatal("percentages must resolve against the filesystem size", target, total, err)
+	}
+}
+
+func TestInvalidWatermarks(t *testing.T) {
+	for _, config := range []Config{
+		{TempDir: "tmp", HighWatermark: Watermark{Bytes: 10}, LowWatermark: Watermark{Bytes: 20}},
+		{TempDir: "tmp", LowWatermark: Watermark{Bytes: 20}},
+		{TempDir: "tmp", HighWatermark: Watermark{Percent: 120}},
+	} {
+		if _, err := New(config, nil); err == nil {
+			t.Fatal("invalid watermarks must be rejected", config.HighWatermark, config.LowWatermark)
+		}
+	}
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	ctx := context.Background()
+
+	var free int64 = 1000
+	diskSpace = func(dir string) (int64, int64, error) { return 10000, free, nil }
+	defer func() { diskSpace = statDiskSpace }()
+
+	fc := MustNew(Config{TempDir: "tmp", MinFreeSpace: Watermark{Percent: 5}}, nil)
+	defer fc.Destroy(ctx)
+
+	for i := 0; i < 3; i++ {
+		if err := fc.Write(ctx, fmt.Sprintf("key%d", i), sampleReader("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	free = 485
+	if err := fc.Write(ctx, "key3", sampleReader("0123456789")); !errors.Is(err, ErrLowDiskSpace) {
+		t.Fatal("writes must be refused below the free space floor", err)
+	}
+	if result, _ := fc.cleanCachedFiles(ctx); result.LRUEvicted != 2 {
+		t.Fatal("the GC must evict until the floor is free", result)
+	}
+}
+
+func TestDiskSpaceUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	diskSpace = func(dir string) (int64, int64, error) { return 0, 0, errDiskSpaceUnsupported }
+	defer func() { diskSpace = statDiskSpace }()
+
+	fc := MustNew(Config{
+		TempDir:       "tmp",
+		HighWatermark: Watermark{Percent: 50},
+		MinFreeSpace:  Watermark{Percent: 5},
+	}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal("MinFreeSpace must be disabled without disk space support", err)
+	}
+	if _, err := fc.CleanNow(ctx); err != nil || !fc.Has("key") {
+		t.Fatal("watermarks must be disabled without disk space support", err)
+	}
+}
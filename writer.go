@@ -0,0 +1,386 @@
+package filecache
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writer streams a new entry into a temp file, the entry only becomes
+// visible once Close succeeds. The key lock is held until Close or Abort,
+// except while Close makes room with Config.EvictBeforeWrite.
+type Writer struct {
+	fc        *FileCache
+	ctx       context.Context
+	key       string
+	tmp       *os.File
+	lock      ILock
+	hash      hash.Hash
+	modTime   time.Time
+	ttl       time.Duration
+	written   int64
+	overwrite bool
+	admitted  bool
+	finished  bool
+}
+
+// Create returns a writer for a new entry of key. The content is written to
+// a temp file which is synced and atomically renamed into place on Close.
+//
+// The caller must call either Close or Abort, otherwise the temp file and
+// the key lock are leaked; the temp file is then only removed by the orphan
+// cleanup.
+func (f *FileCache) Create(ctx context.Context, key string) (*Writer, error) {
+	w, err := f.create(ctx, key, WriteOptions{})
+	return w, opError("write", key, err)
+}
+
+func (f *FileCache) create(ctx context.Context, key string, opts WriteOptions) (*Writer, error) {
+	if err := f.validateKey(key); err != nil {
+		return nil, err
+	}
+	if len(opts.TempDir) > 0 {
+		if err := checkSameDevice(f.BaseDir, opts.TempDir); err != nil {
+			return nil, err
+		}
+	}
+	if deficit, err := f.freeSpaceDeficit(); err != nil {
+		return nil, err
+	} else if deficit > 0 {
+		return nil, ErrLowDiskSpace
+	}
+
+	if err := f.admission.acquire(ctx); err != nil {
+		return nil, err
+	}
+	w := &Writer{fc: f, ctx: ctx, key: key, admitted: true}
+	if f.ChecksumWrites {
+		w.hash = f.newHash()
+	}
+	if f.lockFactory != nil {
+		lock, err := f.lockFactory.Lock(ctx, f.keylock(key))
+		if err != nil {
+			w.release()
+			return nil, err
+		}
+		w.lock = lock
+	}
+
+	w.overwrite = opts.Overwrite
+	w.modTime = opts.ModTime
+	w.ttl = opts.TTL
+	absFilePath, err := f.hasFile(ctx, key)
+	if err == nil && !w.overwrite {
+		w.release()
+		return nil, ErrKeyExists
+	}
+	if errors.Is(err, ErrKeyIsDirectory) {
+		w.release()
+		return nil, err
+	}
+	if err := f.checkSafePath(absFilePath); err != nil {
+		w.release()
+		return nil, err
+	}
+
+	if f.Fanout > 0 {
+		if err := mkdirAll(filepath.Dir(absFilePath), defaultDirFileMode); err != nil {
+			w.release()
+			return nil, err
+		}
+	}
+	tmp, err := f.createTemp(filepath.Dir(absFilePath), opts)
+	if err != nil {
+		w.release()
+		return nil, err
+	}
+	w.tmp = tmp
+	return w, nil
+}
+
+// createTemp creates the temp file of a write. Unless a temp dir is given
+// in opts, it is created in the destination dir so the final rename never
+// crosses filesystems, falling back to TempDir when the destination dir is
+// not writable.
+func (f *FileCache) createTemp(dir string, opts WriteOptions) (*os.File, error) {
+	if len(opts.TempDir) > 0 {
+		return os.CreateTemp(opts.TempDir, tempFilePrefix+"*")
+	}
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		f.Logger.WithError(err).Debug("Falling back to the temp dir")
+		return os.CreateTemp(f.TempDir, tempFilePrefix+"*")
+	}
+	return tmp, nil
+}
+
+// Write writes p to the temp file. It fails once the context of the writer
+// is done, so a long copy into the writer stops at the next write.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.finished {
+		return 0, os.ErrClosed
+	}
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if max := w.fc.MaxEntrySize; max > 0 && w.written+int64(len(p)) > max {
+		return 0, ErrEntryTooLarge
+	}
+	if w.hash != nil {
+		w.hash.Write(p)
+	}
+	n, err := w.tmp.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close syncs the temp file, unless Config.SkipSync is set, and renames it
+// into place. When the context of the writer is done, the entry is not
+// written and the temp file is removed.
+func (w *Writer) Close() error {
+	return opError("write", w.key, w.close())
+}
+
+func (w *Writer) close() error {
+	if w.finished {
+		return os.ErrClosed
+	}
+	defer w.release()
+
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if w.written < w.fc.MinEntrySize {
+		return ErrEntryTooSmall
+	}
+	if !w.fc.SkipSync {
+		if err := w.tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	info, err := w.tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if err := w.tmp.Close(); err != nil {
+		return err
+	}
+	if w.fc.CommitValidator != nil {
+		if err := w.fc.CommitValidator(w.tmp.Name(), info.Size()); err != nil {
+			return &rejectedError{err: err}
+		}
+	}
+	w.fc.frequency.add(w.key)
+	if err := w.fc.admit(w.ctx, w.key, info.Size()); err != nil {
+		return err
+	}
+	if w.fc.EvictBeforeWrite {
+		if err := w.makeRoom(info.Size()); err != nil {
+			return err
+		}
+	}
+	absFilePath, old, err := w.commit()
+	if err != nil {
+		return err
+	}
+	w.fc.misses.remove(w.key)
+	existed := old != nil
+	if existed {
+		w.fc.usage.add(info.Size()-old.Size(), 0)
+	} else {
+		w.fc.usage.add(info.Size(), 1)
+	}
+	w.fc.trigger.add(info.Size(), w.fc.GCWriteThreshold)
+	stamp := w.modTime
+	if stamp.IsZero() {
+		stamp = time.Now()
+	} else if err := w.fc.touch(w.key, stamp); err != nil {
+		return err
+	}
+	// the sidecar fills in the expiry and the pin of the indexed entry
+	entry := indexEntry{name: w.fc.fileName(w.key), size: info.Size(), modTime: stamp}
+	w.fc.index.put(entry)
+	if err := w.commitSidecar(existed, stamp, info.Size()); err != nil {
+		return err
+	}
+
+	if w.fc.OnWrite != nil {
+		if err := w.fc.notifyWrite(w.ctx, w.key, info.Size()); err != nil && w.fc.OnWriteFailsWrite {
+			os.Remove(absFilePath)
+			w.fc.usage.add(-info.Size(), -1)
+			w.fc.index.remove(entry.name)
+			w.fc.removeSidecar(w.ctx, w.key)
+			return err
+		} else if err != nil {
+			w.fc.Logger.WithError(err).WithField("key", w.key).Warn("OnWrite hook failed")
+		}
+	}
+	w.fc.root.activity.addWrite()
+	reason := ReasonNew
+	if existed {
+		reason = ReasonOverwrite
+	}
+	w.fc.callHook("OnWrite", w.fc.Hooks.OnWrite, w.key, info.Size(), reason)
+	w.fc.emit(Event{Type: EventWritten, Key: w.key, Size: info.Size(), Reason: reason})
+	return nil
+}
+
+// makeRoom evicts entries so the entry fits within MaxSize. The key lock
+// is released meanwhile, as the global lock taken to evict must never be
+// waited for holding a key lock, and taken back before the commit.
+func (w *Writer) makeRoom(size int64) error {
+	if w.lock != nil {
+		w.lock.Unlock(w.ctx)
+		w.lock = nil
+	}
+	err := w.fc.makeRoom(w.ctx, w.key, size)
+	if w.fc.lockFactory != nil {
+		lock, lockErr := w.fc.lockFactory.Lock(w.ctx, w.fc.keylock(w.key))
+		if lockErr != nil {
+			if err == nil {
+				err = lockErr
+			}
+			return err
+		}
+		w.lock = lock
+	}
+	return err
+}
+
+// rejectedError wraps an error of Config.CommitValidator, it matches both
+// ErrCommitRejected and the wrapped error with errors.Is.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("commit rejected: %v", e.err)
+}
+
+func (e *rejectedError) Is(target error) bool {
+	return target == ErrCommitRejected
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// commitSidecar replaces the sidecar of a committed entry: the metadata of
+// the previous entry is dropped but its pin and access count are kept, and
+// the attributes of the new one known at write time are recorded.
+func (w *Writer) commitSidecar(existed bool, writtenAt time.Time, size int64) error {
+	sc := sidecar{Size: size}
+	if isHashedName(w.fc.fileName(w.key)) {
+		sc.Key = w.key
+	}
+	if w.hash != nil {
+		sc.Checksum, sc.ChecksumAlgorithm = hex.EncodeToString(w.hash.Sum(nil)), w.fc.hashAlgorithm()
+	}
+	if w.fc.MaxServeAge > 0 || w.fc.RefreshAhead > 0 {
+		sc.WrittenAt = writtenAt.UnixNano()
+	}
+	if w.ttl > 0 {
+		sc.ExpiresAt = writtenAt.Add(w.ttl).UnixNano()
+	}
+	if w.fc.PersistAccessTime {
+		sc.AccessedAt = writtenAt.UnixNano()
+	}
+	if existed {
+		// pins and access counts are held by the key, not by its content
+		if old, err := w.fc.readSidecar(w.key); err == nil {
+			sc.Pinned, sc.Hits = old.Pinned, old.Hits
+		}
+	}
+	if !sc.isZero() {
+		w.fc.sidecarMutex.Lock()
+		defer w.fc.sidecarMutex.Unlock()
+		return w.fc.writeSidecar(w.ctx, w.key, sc)
+	}
+	if existed {
+		return w.fc.removeSidecar(w.ctx, w.key)
+	}
+	return nil
+}
+
+// commit renames the temp file into place, returning the info of the entry
+// it replaced, if any. The existence check and the rename are done in one
+// critical section, so the loser of concurrent writes of a new key gets
+// ErrKeyExists instead of silently replacing the winner.
+func (w *Writer) commit() (string, fs.FileInfo, error) {
+	w.fc.commitMutex.Lock()
+	defer w.fc.commitMutex.Unlock()
+
+	absFilePath, err := w.fc.hasFile(w.ctx, w.key)
+	var old fs.FileInfo
+	if err == nil {
+		if !w.overwrite {
+			return absFilePath, nil, ErrKeyExists
+		}
+		if old, err = os.Stat(absFilePath); err != nil {
+			return absFilePath, nil, err
+		}
+	}
+	if err := w.fc.checkSafePath(absFilePath); err != nil {
+		return absFilePath, old, err
+	}
+	return absFilePath, old, w.rename(absFilePath)
+}
+
+// rename moves the temp file to absFilePath. When the directory of the
+// entry was removed while the temp file was staged in another directory,
+// the directory is recreated and the rename attempted once more.
+func (w *Writer) rename(absFilePath string) error {
+	rename := func() error { return renameFile(w.tmp.Name(), absFilePath) }
+	err := w.fc.retry(w.ctx, rename)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if _, statErr := os.Stat(w.tmp.Name()); statErr != nil {
+		// the temp file went away with its directory
+		return err
+	}
+	if err := mkdirAll(filepath.Dir(absFilePath), defaultDirFileMode); err != nil {
+		return err
+	}
+	return w.fc.retry(w.ctx, rename)
+}
+
+// notifyWrite calls Config.OnWrite, turning a panic into an error.
+func (f *FileCache) notifyWrite(ctx context.Context, key string, size int64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in OnWrite: %v", r)
+		}
+	}()
+	return f.OnWrite(ctx, key, size)
+}
+
+// Abort discards the temp file, the entry is not written.
+func (w *Writer) Abort() error {
+	if w.finished {
+		return nil
+	}
+	w.release()
+	return nil
+}
+
+func (w *Writer) release() {
+	w.finished = true
+	if w.tmp != nil {
+		w.tmp.Close()
+		os.Remove(w.tmp.Name())
+	}
+	if w.lock != nil {
+		w.lock.Unlock(w.ctx)
+	}
+	if w.admitted {
+		w.fc.admission.release()
+		w.admitted = false
+	}
+}
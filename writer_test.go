@@ -0,0 +1,354 @@
+package filecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	w, err := fc.Create(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "AB")
+	if fc.Has("key") {
+		t.Fatal("key must not be visible before Close")
+	}
+	io.WriteString(w, "C")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := fc.Read(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "ABC" {
+		t.Fatal("data not match")
+	}
+
+	if _, err := fc.Create(ctx, "key"); err == nil {
+		t.Fatal("must duplicate error")
+	}
+}
+
+func TestCreateAbort(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	w, err := fc.Create(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "ABC")
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Has("key") {
+		t.Fatal("aborted key must not be written")
+	}
+	if _, err := os.Stat(w.tmp.Name()); !os.IsNotExist(err) {
+		t.Fatal("temp file must be removed")
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("must not close an aborted writer")
+	}
+}
+
+func TestCreateTempInBaseDir(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	w, err := fc.Create(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Abort()
+
+	if filepath.Dir(w.tmp.Name()) != fc.BaseDir {
+		t.Fatal("temp file must be created next to the entry", w.tmp.Name())
+	}
+	if keys, _ := fc.Keys(); len(keys) != 0 {
+		t.Fatal("temp files must not be listed", keys)
+	}
+}
+
+func TestOnWrite(t *testing.T) {
+	ctx := context.Background()
+
+	var written []string
+	errPeer := errors.New("peer unreachable")
+	fc := MustNew(Config{TempDir: "tmp", OnWrite: func(ctx context.Context, key string, size int64) error {
+		written = append(written, fmt.Sprintf("%s:%d", key, size))
+		if key == "fail" {
+			return errPeer
+		}
+		if key == "panic" {
+			panic("boom")
+		}
+		return nil
+	}}, nil)
+	defer fc.Empty(ctx)
+
+	if err := fc.Write(ctx, "key", sampleReader("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.Write(ctx, "fail", sampleReader("ABC")); err != nil {
+		t.Fatal("hook error must only be logged by default", err)
+	}
+	if len(written) != 2 || written[0] != "key:3" {
+		t.Fatal("hook must be called after each write", written)
+	}
+
+	fc.OnWriteFailsWrite = true
+	fc.Delete(ctx, "fail")
+	if err := fc.Write(ctx, "fail", sampleReader("ABC")); !errors.Is(err, errPeer) {
+		t.Fatal("hook error must fail the write", err)
+	}
+	if fc.Has("fail") {
+		t.Fatal("failed write must not leave the entry")
+	}
+	if err := fc.Write(ctx, "panic", sampleReader("ABC")); err == nil {
+		t.Fatal("panic must be recovered as an error")
+	}
+}
+
+func TestConcurrentWritesSameKey(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Empty(ctx)
+
+	const n = 16
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	succeeded, existed := 0, 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := fc.Write(ctx, "key", sampleReader(fmt.Sprint(i)))
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err == nil {
+				succeeded++
+			} else if errors.Is(err, ErrKeyExists) {
+				existed++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 1 || existed != n-1 {
+		t.Fatal("exactly one write must succeed", succeeded, existed)
+	}
+}
+
+func TestMaxEntrySize(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MaxEntrySize: 4}, nil)
+	defer fc.Empty(ctx)
+
+	if err := fc.Write(ctx, "hinted", strings.NewReader("ABCDE")); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatal("hinted oversized write must be rejected", err)
+	}
+	if err := fc.Write(ctx, "streamed", io.MultiReader(strings.NewReader("ABC"), strings.NewReader("DE"))); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatal("streamed oversized write must be rejected", err)
+	}
+	file, err := os.CreateTemp(fc.TempDir, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	file.WriteString("ABCDE")
+	file.Seek(0, io.SeekStart)
+	if err := fc.Write(ctx, "file", file); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatal("oversized file write must be rejected", err)
+	}
+	if offset, _ := file.Seek(0, io.SeekCurrent); offset != 0 {
+		t.Fatal("oversized file must be rejected before being read", offset)
+	}
+	if fc.Has("hinted") || fc.Has("streamed") || fc.Has("file") {
+		t.Fatal("oversized entries must not be written")
+	}
+	entries, _ := os.ReadDir(fc.BaseDir)
+	if len(entries) != 0 {
+		t.Fatal("temp files must be removed", entries)
+	}
+
+	if err := fc.Write(ctx, "key", io.MultiReader(strings.NewReader("AB"), strings.NewReader("CD"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMinEntrySize(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp", MinEntrySize: 4}, nil)
+	defer fc.Destroy(ctx)
+
+	if err := fc.Write(ctx, "hinted", strings.NewReader("ABC")); !errors.Is(err, ErrEntryTooSmall) {
+		t.Fatal("hinted undersized write must be rejected", err)
+	}
+	if err := fc.Write(ctx, "streamed", io.MultiReader(strings.NewReader("AB"), strings.NewReader("C"))); !errors.Is(err, ErrEntryTooSmall) {
+		t.Fatal("streamed undersized write must be rejected", err)
+	}
+	if fc.Has("hinted") || fc.Has("streamed") {
+		t.Fatal("undersized entries must not be written")
+	}
+	entries, _ := os.ReadDir(fc.BaseDir)
+	if len(entries) != 0 {
+		t.Fatal("temp files must be removed", entries)
+	}
+
+	if err := fc.Write(ctx, "key", io.MultiReader(strings.NewReader("AB"), strings.NewReader("CD"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cancelReader cancels its context once read.
+type cancelReader struct {
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return copy(p, "ABC"), nil
+}
+
+func TestWriteCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(context.Background())
+
+	// the reader never ends, the write only stops with its context
+	err := fc.Write(ctx, "key", &cancelReader{cancel: cancel})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("write must stop once its context is done", err)
+	}
+	if fc.Has("key") {
+		t.Fatal("cancelled entry must not be written")
+	}
+	entries, _ := os.ReadDir(fc.BaseDir)
+	if len(entries) != 0 {
+		t.Fatal("temp file must be removed", entries)
+	}
+}
+
+func TestCommitValidator(t *testing.T) {
+	ctx := context.Background()
+
+	errTruncated := errors.New("truncated JSON")
+	fc := MustNew(Config{TempDir: "tmp", CommitValidator: func(tempPath string, size int64) error {
+		data, err := os.ReadFile(tempPath)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != size || !strings.HasSuffix(string(data), "}") {
+			return errTruncated
+		}
+		return nil
+	}}, nil)
+	defer fc.Destroy(ctx)
+
+	err := fc.Write(ctx, "bad", strings.NewReader(`{"a":`))
+	if !errors.Is(err, ErrCommitRejected) || !errors.Is(err, errTruncated) {
+		t.Fatal("invalid content must be rejected", err)
+	}
+	if fc.Has("bad") {
+		t.Fatal("rejected entry must not be written")
+	}
+	entries, _ := os.ReadDir(fc.BaseDir)
+	if len(entries) != 0 {
+		t.Fatal("temp file must be removed", entries)
+	}
+
+	if err := fc.Write(ctx, "good", strings.NewReader(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteParentRemoved(t *testing.T) {
+	ctx := context.Background()
+
+	fc := MustNew(Config{TempDir: "tmp"}, nil)
+	defer fc.Destroy(ctx)
+	ns := fc.Namespace("ns")
+
+	w, err := ns.create(ctx, "key", WriteOptions{TempDir: fc.TempDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "ABC")
+	os.RemoveAll(ns.BaseDir)
+	if err := w.Close(); err != nil {
+		t.Fatal("write must recreate the removed directory", err)
+	}
+	if !ns.Has("key") {
+		t.Fatal("entry must be written")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			os.RemoveAll(ns.BaseDir)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			err := ns.Write(ctx, fmt.Sprintf("key%d", i), sampleReader("ABC"))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.Error("write must succeed or fail as not found", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	temps, _ := filepath.Glob(filepath.Join(fc.TempDir, tempFilePrefix+"*"))
+	nsTemps, _ := filepath.Glob(filepath.Join(ns.BaseDir, tempFilePrefix+"*"))
+	if len(temps)+len(nsTemps) != 0 {
+		t.Fatal("temp files must not leak", temps, nsTemps)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	ctx := context.Background()
+	data := strings.Repeat("a", 64*1024)
+
+	for _, skipSync := range []bool{false, true} {
+		b.Run(fmt.Sprintf("SkipSync=%v", skipSync), func(b *testing.B) {
+			fc := MustNew(Config{TempDir: "tmp", SkipSync: skipSync, Silent: true}, nil)
+			defer fc.Destroy(ctx)
+
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("key%d", i)
+				if err := fc.Write(ctx, key, strings.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}